@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// the size of the buffers that the response bodies are read into, which are reused by all the requests, so that
+// reading a body doesn't allocate a buffer of the size of the object
+const readBufferSize = 64 * 1024
+
+// the buffers that the response bodies are read into and then discarded
+var readBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, readBufferSize)
+		return &buf
+	},
+}
+
+// the zero bytes that the response bodies are compared with, since all the objects that the benchmarks read were
+// uploaded as zero bytes
+var readZeroes = make([]byte, readBufferSize)
+
+// the zero bytes that the uploads send, which are shared by all the requests since the requests only read them, and
+// grow to the largest payload size so far
+var zeroBytes struct {
+	lock sync.Mutex
+	buf  []byte
+}
+
+// returns a payload of zero bytes of the given size, which must not be written to
+func zeroPayload(size uint64) []byte {
+	zeroBytes.lock.Lock()
+	defer zeroBytes.lock.Unlock()
+
+	if uint64(len(zeroBytes.buf)) < size {
+		zeroBytes.buf = make([]byte, size)
+	}
+	return zeroBytes.buf[:size]
+}
+
+// the memory allocations and garbage collections of the process during a test, which show the overhead of the client
+// itself, e.g. if its garbage collection pauses add to the latencies
+type allocStats struct {
+	before runtime.MemStats
+	after  runtime.MemStats
+}
+
+// starts counting the allocations and garbage collections of a test
+func startAllocStats() *allocStats {
+	a := &allocStats{}
+	runtime.ReadMemStats(&a.before)
+	return a
+}
+
+// stops counting the allocations and garbage collections of a test
+func (a *allocStats) stop() {
+	runtime.ReadMemStats(&a.after)
+}
+
+// returns the bytes and the number of objects allocated per request, or per object in the benchmarks that split
+// objects into parts
+func (a *allocStats) perRequest(requests int) (float64, float64) {
+	if requests == 0 {
+		return 0, 0
+	}
+	return float64(a.after.TotalAlloc-a.before.TotalAlloc) / float64(requests),
+		float64(a.after.Mallocs-a.before.Mallocs) / float64(requests)
+}
+
+// returns the number of garbage collections, and their total and longest pause
+func (a *allocStats) gcPauses() (uint32, time.Duration, time.Duration) {
+	cycles := a.after.NumGC - a.before.NumGC
+
+	// the runtime only keeps the pauses of the last 256 garbage collections
+	var longest time.Duration
+	for i := uint32(0); i < cycles && i < uint32(len(a.after.PauseNs)); i++ {
+		pause := time.Duration(a.after.PauseNs[(a.after.NumGC-i+255)%256])
+		if pause > longest {
+			longest = pause
+		}
+	}
+	return cycles, time.Duration(a.after.PauseTotalNs - a.before.PauseTotalNs), longest
+}
+
+// formats the allocations per request and the total garbage collection pause as the columns of the results table
+func (a *allocStats) columns(requests int) string {
+	bytes, _ := a.perRequest(requests)
+	_, pause, _ := a.gcPauses()
+	return fmt.Sprintf(" %9s | %7.1f ", byteFormat(bytes), float64(pause)/float64(time.Millisecond))
+}
+
+// sets the allocations and garbage collections of the results, given the number of requests that were sent
+func (r *result) setAllocations(a *allocStats, requests int) {
+	r.AllocBytesPerRequest, r.AllocsPerRequest = a.perRequest(requests)
+
+	cycles, pause, longest := a.gcPauses()
+	r.GCCycles = cycles
+	r.GCPauseMs = float64(pause) / float64(time.Millisecond)
+	r.GCPauseMaxMs = float64(longest) / float64(time.Millisecond)
+}
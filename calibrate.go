@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// whether to measure the ceiling of the client before the benchmark, by running the same tests against a server
+// without latency on the loopback interface
+var calibrate bool
+
+// the request rate and throughput of the calibration of an object size, which is the most this client can do
+type calibration struct {
+	threads     int
+	requestRate float64
+	throughput  float64
+}
+
+// the calibrations of every object size of the benchmark, if the calibrate argument is set
+var calibrations map[uint64]calibration
+
+// runs the tests of the benchmark with the highest thread count against an in-memory S3 server in this process, through
+// the same SDK client, request signing and buffers, to find out how many requests and bytes per second the client can
+// handle on its own
+func runCalibration() {
+	calibrations = nil
+	if !calibrate {
+		return
+	}
+
+	fmt.Fprint(console, "\n--- \033[1;32mCALIBRATION\033[0m --------------------------------------------------------------------------------------------------------------\n\n")
+
+	m := benchmarkModes[mode]
+
+	// serve S3 on a free port of the loopback interface, without any latency or bandwidth limit, from a store that
+	// only keeps the sizes of the objects
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("Failed to listen on the loopback interface: " + err.Error())
+	}
+	zeroes := newMemoryStore()
+	zeroes.zeroes = true
+	server := &http.Server{Handler: &s3Server{store: zeroes, latency: latencyDistribution{name: "fixed"}}}
+	go func() { _ = server.Serve(listener) }()
+	defer server.Close()
+
+	// the tests run against the loopback server through a client of their own, at full speed, and without recording
+	// their results or metrics
+	defer func(benchmarkStore objectStore) { store = benchmarkStore }(store)
+	store = newS3Store("http://" + listener.Addr().String())
+	config := testConfig{}
+
+	if err := store.CreateBucket(context.Background(), bucketName, region); err != nil {
+		panic("Failed to create the calibration bucket: " + err.Error())
+	}
+	setupObjects()
+
+	calibrations = make(map[uint64]calibration)
+	for _, payload := range payloadSizes {
+		if m.payloadless {
+			fmt.Fprintf(console, "Client ceiling on the loopback interface\n")
+		} else {
+			fmt.Fprintf(console, "Client ceiling on the loopback interface with \033[1;33m%-s\033[0m objects\n", byteFormat(float64(payload)))
+		}
+		threadsTable.printHeader(m.firstByteTitle, m.lastByteTitle)
+		_, r := execTest(config, threadsMax, payload, 1, nil)
+		threadsTable.printFooter()
+
+		calibrations[payload] = calibration{threads: threadsMax, requestRate: r.RequestRate, throughput: r.Throughput}
+
+		// the payload size doesn't matter to some benchmarks, so they only need to run once
+		if m.payloadless {
+			break
+		}
+	}
+}
+
+// prints the calibration of the object size below its results, if the calibrate argument is set
+func printCalibration(payload uint64) {
+	c, ok := calibrations[payload]
+	if !ok {
+		return
+	}
+
+	fmt.Fprintf(console, "Client ceiling on the loopback interface with %d threads: \033[1;31m%.1f op/s\033[0m, \033[1;31m%.1f MB/s\033[0m\n\n",
+		c.threads, c.requestRate, c.throughput)
+}
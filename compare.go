@@ -0,0 +1,404 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// identifies a cell of the results, which is a test of one operation, object size and thread count, that can be
+// compared between runs
+type cellKey struct {
+	scenario    string
+	operation   string
+	objectSize  uint64
+	partSize    uint64
+	threads     int
+	partThreads int
+}
+
+// the number, mean and variance of some values, which is what Welch's t-test compares
+type moments struct {
+	count    float64
+	mean     float64
+	variance float64
+}
+
+// the results of a cell, combined over all the records of the cell in a results file, which are several in
+// throttling mode
+type cellStats struct {
+	// the throughput in MB/s, or in requests per second for the benchmarks that don't transfer payloads, averaged
+	// over all the records, and its moments over the records
+	throughput  float64
+	unit        string
+	throughputs moments
+
+	// the compared percentile of the last byte latencies in milliseconds, averaged over all the records, and its
+	// moments over the records
+	percentile  float64
+	percentiles moments
+}
+
+// the row format of the results table of the compare subcommand
+const compareRowFormat = "| %-12s | %9s | %9s | %7s | %14s | %14s | %7s | %7s | %9s | %9s | %7s | %7s | %s |\n"
+
+// compares two results files of this tool cell by cell, and returns a non-zero exit code if any cell regressed by
+// more than the threshold with statistical significance
+func runCompare(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	thresholdArg := flags.Float64("threshold", 10, "The regression threshold in percent, for both a drop in throughput and an increase in the latency percentile.")
+	percentileArg := flags.Float64("percentile", 99, "The percentile of the last byte latencies to compare, which must be in both results files.")
+	alphaArg := flags.Float64("alpha", 0.05, "The significance level of Welch's t-tests of the throughputs and latency percentiles of the runs in throttling mode, below which a difference is significant.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: s3-benchmark compare [options] <baseline results> <candidate results>")
+		fmt.Fprintln(flags.Output(), "Compares two JSON, NDJSON or CSV results files of this tool, and exits with 1 if the candidate regressed.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	label := percentileLabel(*percentileArg)
+	baseline := loadCells(flags.Arg(0), label)
+	candidate := loadCells(flags.Arg(1), label)
+
+	fmt.Printf("Comparing \033[1;33m%s\033[0m (baseline) with \033[1;33m%s\033[0m (candidate)\n", flags.Arg(0), flags.Arg(1))
+	fmt.Printf("Regressions are changes of the throughput or the latency of more than %.1f%%, with p < %g where tested\n\n", *thresholdArg, *alphaArg)
+
+	header := fmt.Sprintf(compareRowFormat, "Operation", "Object", "Part", "Threads", "Baseline", "Candidate", "Change",
+		"p-value", label+" base", label+" cand", "Change", "p-value", fmt.Sprintf("%-10s", "Result"))
+	separator := "+" + strings.Repeat("-", len(header)-3) + "+"
+	fmt.Println(separator)
+	fmt.Print(header)
+	fmt.Println(separator)
+
+	regressions := 0
+	compared := 0
+	for _, key := range sortedCellKeys(baseline) {
+		b := baseline[key]
+		c, ok := candidate[key]
+		if !ok {
+			continue
+		}
+		compared++
+
+		// the throughput and the latency are judged on their own, so that either can regress while the other doesn't
+		throughputChange := percentChange(b.throughput, c.throughput)
+		throughputP, throughputTested := runsTest(b.throughputs, c.throughputs)
+		throughputVerdict := verdict(-throughputChange, throughputP, throughputTested, *thresholdArg, *alphaArg)
+
+		latencyChange := percentChange(b.percentile, c.percentile)
+		latencyP, latencyTested := runsTest(b.percentiles, c.percentiles)
+		latencyVerdict := verdict(latencyChange, latencyP, latencyTested, *thresholdArg, *alphaArg)
+
+		result, color := "same", "\033[0m"
+		switch {
+		case throughputVerdict == "regression" || latencyVerdict == "regression":
+			result, color = "regression", "\033[1;31m"
+			regressions++
+		case throughputVerdict == "improved" || latencyVerdict == "improved":
+			result, color = "improved", "\033[1;32m"
+		case throughputVerdict == "changed" || latencyVerdict == "changed":
+			result = "changed"
+		}
+
+		throughputPValue := "-"
+		if throughputTested {
+			throughputPValue = fmt.Sprintf("%.4f", throughputP)
+		}
+		latencyPValue := "-"
+		if latencyTested {
+			latencyPValue = fmt.Sprintf("%.4f", latencyP)
+		}
+
+		partSize := "-"
+		threads := strconv.Itoa(key.threads)
+		if key.partSize > 0 {
+			partSize = byteFormat(float64(key.partSize))
+			threads = strconv.Itoa(key.partThreads)
+		}
+
+		operation := key.operation
+		if key.scenario != "" {
+			operation = key.scenario + "/" + key.operation
+		}
+
+		fmt.Printf(compareRowFormat, operation, byteFormat(float64(key.objectSize)), partSize, threads,
+			fmt.Sprintf("%.1f %s", b.throughput, b.unit), fmt.Sprintf("%.1f %s", c.throughput, c.unit),
+			fmt.Sprintf("%+.1f%%", throughputChange), throughputPValue,
+			fmt.Sprintf("%.1f", b.percentile), fmt.Sprintf("%.1f", c.percentile), fmt.Sprintf("%+.1f%%", latencyChange),
+			latencyPValue, fmt.Sprintf("%s%-10s\033[0m", color, result))
+	}
+	fmt.Print(separator + "\n\n")
+
+	// the cells that can't be compared are listed, but never count as regressions
+	for _, key := range sortedCellKeys(baseline) {
+		if _, ok := candidate[key]; !ok {
+			fmt.Printf("Only in the baseline: %s\n", key)
+		}
+	}
+	for _, key := range sortedCellKeys(candidate) {
+		if _, ok := baseline[key]; !ok {
+			fmt.Printf("Only in the candidate: %s\n", key)
+		}
+	}
+
+	if compared == 0 {
+		fmt.Println("No cells in common")
+		return 2
+	}
+
+	if regressions > 0 {
+		fmt.Printf("\033[1;31m%d of %d cells regressed\033[0m\n", regressions, compared)
+		return 1
+	}
+
+	fmt.Printf("No regressions in %d cells\n", compared)
+	return 0
+}
+
+// loads a results file of this tool in any of its formats, and combines the records of every cell
+func loadCells(path string, percentile string) map[cellKey]*cellStats {
+	results := loadResults(path).Results
+
+	// group the records of every cell, including the operations of the mixed benchmark
+	records := make(map[cellKey][]result)
+	for _, r := range results {
+		for _, o := range withOperations(r) {
+			key := cellKey{o.Scenario, o.Operation, o.ObjectSize, o.PartSize, o.Threads, o.PartThreads}
+			records[key] = append(records[key], o)
+		}
+	}
+
+	cells := make(map[cellKey]*cellStats)
+	for key, rs := range records {
+		cells[key] = combineRecords(rs, percentile, path)
+	}
+	return cells
+}
+
+// combines the records of a cell, with the moments of the throughputs and latency percentiles of the records
+func combineRecords(records []result, percentile string, path string) *cellStats {
+	stats := &cellStats{unit: "MB/s"}
+
+	var throughputs, percentiles []float64
+	for _, r := range records {
+		p, ok := r.LastByte.Percentiles[percentile]
+		if !ok {
+			panic("The results file " + path + " has no " + percentile + " latencies")
+		}
+		percentiles = append(percentiles, p)
+
+		if r.Bytes > 0 {
+			throughputs = append(throughputs, r.Throughput)
+		} else {
+			throughputs = append(throughputs, r.RequestRate)
+			stats.unit = "op/s"
+		}
+	}
+
+	stats.throughputs = momentsOf(throughputs)
+	stats.throughput = stats.throughputs.mean
+	stats.percentiles = momentsOf(percentiles)
+	stats.percentile = stats.percentiles.mean
+	return stats
+}
+
+// returns the number, mean and unbiased variance of the values
+func momentsOf(values []float64) moments {
+	m := moments{count: float64(len(values))}
+	if len(values) == 0 {
+		return m
+	}
+
+	for _, v := range values {
+		m.mean += v
+	}
+	m.mean /= m.count
+
+	if len(values) > 1 {
+		for _, v := range values {
+			m.variance += (v - m.mean) * (v - m.mean)
+		}
+		m.variance /= m.count - 1
+	}
+	return m
+}
+
+// returns the cell keys in a stable order, by operation, object size, part size and thread counts
+func sortedCellKeys(cells map[cellKey]*cellStats) []cellKey {
+	var keys []cellKey
+	for key := range cells {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.scenario != b.scenario {
+			return a.scenario < b.scenario
+		}
+		if a.operation != b.operation {
+			return a.operation < b.operation
+		}
+		if a.objectSize != b.objectSize {
+			return a.objectSize < b.objectSize
+		}
+		if a.partSize != b.partSize {
+			return a.partSize < b.partSize
+		}
+		if a.threads != b.threads {
+			return a.threads < b.threads
+		}
+		return a.partThreads < b.partThreads
+	})
+	return keys
+}
+
+// formats the cell key for the cells that can't be compared
+func (k cellKey) String() string {
+	scenario := ""
+	if k.scenario != "" {
+		scenario = " in scenario " + k.scenario
+	}
+	if k.partSize > 0 {
+		return fmt.Sprintf("%s of %s objects in %s parts with %d threads%s", k.operation, byteFormat(float64(k.objectSize)), byteFormat(float64(k.partSize)), k.partThreads, scenario)
+	}
+	return fmt.Sprintf("%s of %s objects with %d threads%s", k.operation, byteFormat(float64(k.objectSize)), k.threads, scenario)
+}
+
+// returns the change from the baseline to the candidate in percent
+func percentChange(baseline float64, candidate float64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return (candidate - baseline) / baseline * 100
+}
+
+// returns whether a change in percent, where a positive change is worse, is a regression, an improvement, a change
+// that is significant but within the threshold, or the same, where a change that couldn't be tested for significance
+// is judged against the threshold alone
+func verdict(change float64, p float64, tested bool, threshold float64, alpha float64) string {
+	if tested && p >= alpha {
+		return "same"
+	}
+	switch {
+	case change > threshold:
+		return "regression"
+	case change < -threshold:
+		return "improved"
+	case tested:
+		return "changed"
+	}
+	return "same"
+}
+
+// returns the two-sided p-value of Welch's t-test of the throughputs or latency percentiles of the runs of two cells,
+// and whether they could be tested, which needs at least two runs of each, e.g. in throttling mode
+func runsTest(a moments, b moments) (float64, bool) {
+	if a.count < 2 || b.count < 2 {
+		return 0, false
+	}
+	return welchTest(a, b), true
+}
+
+// returns the two-sided p-value of Welch's t-test of the means of two samples, which doesn't assume that both have
+// the same variance
+func welchTest(a moments, b moments) float64 {
+	if a.count < 2 || b.count < 2 {
+		return 1
+	}
+
+	va := a.variance / a.count
+	vb := b.variance / b.count
+	if va+vb == 0 {
+		if a.mean == b.mean {
+			return 1
+		}
+		return 0
+	}
+
+	t := (a.mean - b.mean) / math.Sqrt(va+vb)
+
+	// the Welch-Satterthwaite approximation of the degrees of freedom
+	df := (va + vb) * (va + vb) / (va*va/(a.count-1) + vb*vb/(b.count-1))
+
+	// the two-sided tail probability of the t distribution
+	return regularizedBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// returns the regularized incomplete beta function I_x(a, b)
+func regularizedBeta(x float64, a float64, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	// the continued fraction converges quickly on this side of the mean, and the symmetry covers the other side
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(x, a, b) / a
+	}
+	return 1 - front*betaFraction(1-x, b, a)/b
+}
+
+// evaluates the continued fraction of the incomplete beta function with the modified Lentz method
+func betaFraction(x float64, a float64, b float64) float64 {
+	const tiny = 1e-300
+	const epsilon = 1e-14
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+
+		// the even step
+		num := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		// the odd step
+		num = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + num*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + num/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRegularizedBeta(t *testing.T) {
+	tests := []struct {
+		x, a, b  float64
+		expected float64
+	}{
+		// I_x(1, 1) = x, I_x(a, 1) = x^a and I_x(1, b) = 1 - (1 - x)^b
+		{0.3, 1, 1, 0.3},
+		{0.5, 3, 1, 0.125},
+		{0.5, 1, 3, 0.875},
+		{0.2, 2.5, 1, math.Pow(0.2, 2.5)},
+
+		// symmetric around the middle
+		{0.5, 7, 7, 0.5},
+		{0.5, 0.5, 0.5, 0.5},
+
+		{0, 2, 3, 0},
+		{1, 2, 3, 1},
+	}
+	for _, test := range tests {
+		if got := regularizedBeta(test.x, test.a, test.b); math.Abs(got-test.expected) > 1e-9 {
+			t.Errorf("I_%g(%g, %g): expected %g, got %g", test.x, test.a, test.b, test.expected, got)
+		}
+	}
+}
+
+// returns the two-sided p-value of the t distribution with the given degrees of freedom
+func tDistributionP(t float64, df float64) float64 {
+	return regularizedBeta(df/(df+t*t), df/2, 0.5)
+}
+
+func TestTDistribution(t *testing.T) {
+	tests := []struct {
+		t, df    float64
+		expected float64
+	}{
+		// the critical values of the two-sided t-test from the tables
+		{12.706205, 1, 0.05},
+		{2.776445, 4, 0.05},
+		{2.228139, 10, 0.05},
+		{3.169273, 10, 0.01},
+		{1.983972, 100, 0.05},
+
+		// with one degree of freedom, the t distribution is the Cauchy distribution
+		{2, 1, 1 - 2/math.Pi*math.Atan(2)},
+		{0, 5, 1},
+	}
+	for _, test := range tests {
+		if got := tDistributionP(test.t, test.df); math.Abs(got-test.expected) > 1e-5 {
+			t.Errorf("t = %g with %g degrees of freedom: expected p = %g, got %g", test.t, test.df, test.expected, got)
+		}
+	}
+}
+
+func TestWelchTest(t *testing.T) {
+	// with 6 values of the same variance in both samples, there are 10 degrees of freedom, and t = 2.228139 is the
+	// critical value for p = 0.05
+	a := moments{count: 6, mean: 10, variance: 3}
+	b := moments{count: 6, mean: 10 + 2.228139, variance: 3}
+	if p := welchTest(a, b); math.Abs(p-0.05) > 1e-5 {
+		t.Fatalf("Expected p = 0.05, got %g", p)
+	}
+	if p := welchTest(b, a); math.Abs(p-0.05) > 1e-5 {
+		t.Fatalf("Expected the test to be symmetric, got %g", p)
+	}
+
+	// samples of different sizes and variances have fewer degrees of freedom than in total, 12.7 here
+	a = moments{count: 5, mean: 20, variance: 4}
+	b = moments{count: 10, mean: 25, variance: 25}
+	t0 := 5 / math.Sqrt(4.0/5+25.0/10)
+	df := math.Pow(4.0/5+25.0/10, 2) / (math.Pow(4.0/5, 2)/4 + math.Pow(25.0/10, 2)/9)
+	if p := welchTest(a, b); math.Abs(p-tDistributionP(t0, df)) > 1e-12 || p < 0.01 || p > 0.02 {
+		t.Fatalf("Expected p = %g, got %g", tDistributionP(t0, df), p)
+	}
+
+	if p := welchTest(a, a); p != 1 {
+		t.Fatalf("Expected p = 1 for the same samples, got %g", p)
+	}
+	if p := welchTest(moments{count: 3, mean: 1}, moments{count: 3, mean: 2}); p != 0 {
+		t.Fatalf("Expected p = 0 for different samples without variance, got %g", p)
+	}
+	if p := welchTest(moments{count: 1, mean: 1}, moments{count: 3, mean: 2, variance: 1}); p != 1 {
+		t.Fatalf("Expected p = 1 for a single value, got %g", p)
+	}
+}
+
+func TestCompareThroughputOnItsOwn(t *testing.T) {
+	latencies := latencyStats{Count: 1000, Avg: 50, Stddev: 5, Percentiles: map[string]float64{"p99": 65}}
+	baseline := combineRecords([]result{{Bytes: 1, Throughput: 100, LastByte: latencies}}, "p99", "baseline")
+	candidate := combineRecords([]result{{Bytes: 1, Throughput: 50, LastByte: latencies}}, "p99", "candidate")
+
+	// the latencies are the same, but the throughput dropped by half
+	p, tested := runsTest(baseline.percentiles, candidate.percentiles)
+	if v := verdict(percentChange(baseline.percentile, candidate.percentile), p, tested, 10, 0.05); v != "same" {
+		t.Fatalf("Expected the same latencies, got %s", v)
+	}
+	p, tested = runsTest(baseline.throughputs, candidate.throughputs)
+	if tested {
+		t.Fatal("Expected a single run to have no throughput test")
+	}
+	if v := verdict(-percentChange(baseline.throughput, candidate.throughput), p, tested, 10, 0.05); v != "regression" {
+		t.Fatalf("Expected the throughput to regress, got %s", v)
+	}
+
+	// with several runs in throttling mode, the throughput is tested too
+	noisy := combineRecords([]result{
+		{Bytes: 1, Throughput: 60, LastByte: latencies},
+		{Bytes: 1, Throughput: 140, LastByte: latencies},
+	}, "p99", "candidate")
+	steady := combineRecords([]result{
+		{Bytes: 1, Throughput: 99, LastByte: latencies},
+		{Bytes: 1, Throughput: 101, LastByte: latencies},
+	}, "p99", "baseline")
+	p, tested = runsTest(steady.throughputs, noisy.throughputs)
+	if !tested || p < 0.05 {
+		t.Fatalf("Expected the noisy runs not to differ significantly, got p = %g", p)
+	}
+}
+
+func TestCompareTailLatency(t *testing.T) {
+	// the mean latency is stable, but the p99 doubled
+	stable := latencyStats{Count: 1000, Avg: 50, Stddev: 5, Percentiles: map[string]float64{"p99": 65}}
+	tail := latencyStats{Count: 1000, Avg: 50, Stddev: 20, Percentiles: map[string]float64{"p99": 130}}
+	baseline := combineRecords([]result{{Bytes: 1, Throughput: 100, LastByte: stable}}, "p99", "baseline")
+	candidate := combineRecords([]result{{Bytes: 1, Throughput: 100, LastByte: tail}}, "p99", "candidate")
+
+	// a single run is judged against the threshold alone
+	p, tested := runsTest(baseline.percentiles, candidate.percentiles)
+	if tested {
+		t.Fatal("Expected a single run to have no latency test")
+	}
+	if v := verdict(percentChange(baseline.percentile, candidate.percentile), p, tested, 10, 0.05); v != "regression" {
+		t.Fatalf("Expected the p99 to regress, got %s", v)
+	}
+
+	// the percentiles of several runs are tested against each other
+	runs := func(percentiles ...float64) *cellStats {
+		var records []result
+		for _, p := range percentiles {
+			records = append(records, result{Bytes: 1, Throughput: 100,
+				LastByte: latencyStats{Count: 1000, Avg: 50, Stddev: 5, Percentiles: map[string]float64{"p99": p}}})
+		}
+		return combineRecords(records, "p99", "runs")
+	}
+	baseline, candidate = runs(64, 65, 66), runs(128, 130, 132)
+	p, tested = runsTest(baseline.percentiles, candidate.percentiles)
+	if !tested || verdict(percentChange(baseline.percentile, candidate.percentile), p, tested, 10, 0.05) != "regression" {
+		t.Fatalf("Expected a significant regression of the p99, got p = %g", p)
+	}
+	baseline, candidate = runs(60, 65, 70), runs(40, 80, 120)
+	if p, _ = runsTest(baseline.percentiles, candidate.percentiles); p < 0.05 {
+		t.Fatalf("Expected the noisy p99 not to differ significantly, got p = %g", p)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// the writers of the csv results, which get every row as soon as a test is done
+var csvWriters []*csv.Writer
+
+// the local csv file, if the csv argument is set
+var csvFileCloser io.Closer
+
+// returns the header row of the csv results, where the latency columns depend on the percentiles argument
+func csvHeader() []string {
+	header := []string{
+		"timestamp",
+		"run_id",
+		"scenario",
+		"hostname",
+		"instance_type",
+		"mode",
+		"operation",
+		"object_size",
+		"part_size",
+		"threads",
+		"part_threads",
+		"run",
+		"samples",
+		"bytes",
+		"seconds",
+		"throughput_mb_per_second",
+		"requests_per_second",
+		"objects_per_second",
+		"errors",
+		"error_percent",
+		"retries",
+		"alloc_bytes_per_request",
+		"allocs_per_request",
+		"gc_cycles",
+		"gc_pause_ms",
+		"gc_pause_max_ms",
+		"cpu_percent",
+		"cpu_percent_max",
+		"rss_bytes",
+		"nic_rx_bytes",
+		"nic_tx_bytes",
+		"client_bound",
+	}
+	for _, class := range errorClasses {
+		header = append(header, "errors_"+class)
+	}
+	header = append(header, "client_ceiling_requests_per_second", "client_ceiling_mb_per_second")
+	for _, column := range []string{"first_byte", "last_byte"} {
+		for _, label := range statLabels() {
+			header = append(header, column+"_"+label+"_ms")
+		}
+	}
+	return header
+}
+
+// returns the csv rows of the results of one benchmark record, which is one row, followed by a row for every operation
+// of the mixed benchmark
+func csvRows(r result) [][]string {
+	var rows [][]string
+	for _, o := range withOperations(r) {
+		rows = append(rows, csvRow(o))
+	}
+	return rows
+}
+
+// formats the results of one benchmark record as a csv row, in the order of the header row
+func csvRow(r result) []string {
+	row := []string{
+		r.Time.Format(time.RFC3339),
+		run.RunID,
+		r.Scenario,
+		hostname,
+		instanceType,
+		mode,
+		r.Operation,
+		strconv.FormatUint(r.ObjectSize, 10),
+		strconv.FormatUint(r.PartSize, 10),
+		strconv.Itoa(r.Threads),
+		strconv.Itoa(r.PartThreads),
+		strconv.Itoa(r.Run),
+		strconv.Itoa(r.Samples),
+		strconv.FormatUint(r.Bytes, 10),
+		csvFloat(r.Seconds),
+		csvFloat(r.Throughput),
+		csvFloat(r.RequestRate),
+		csvFloat(r.ObjectRate),
+		strconv.FormatUint(r.Errors, 10),
+		csvFloat(r.ErrorPercent),
+		strconv.FormatUint(r.Retries, 10),
+		csvFloat(r.AllocBytesPerRequest),
+		csvFloat(r.AllocsPerRequest),
+		strconv.FormatUint(uint64(r.GCCycles), 10),
+		csvFloat(r.GCPauseMs),
+		csvFloat(r.GCPauseMaxMs),
+		csvFloat(r.CPUPercent),
+		csvFloat(r.CPUPercentMax),
+		strconv.FormatUint(r.RSSBytes, 10),
+		strconv.FormatUint(r.NICRxBytes, 10),
+		strconv.FormatUint(r.NICTxBytes, 10),
+		r.ClientBound,
+	}
+	for _, class := range errorClasses {
+		row = append(row, strconv.FormatUint(r.ErrorClasses[class], 10))
+	}
+	row = append(row, csvFloat(r.CeilingRequestRate), csvFloat(r.CeilingThroughput))
+	for _, stats := range []latencyStats{r.FirstByte, r.LastByte} {
+		row = append(row, csvFloat(stats.Avg), csvFloat(stats.Stddev), csvFloat(stats.Min))
+		for _, q := range percentiles {
+			row = append(row, csvFloat(stats.Percentiles[percentileLabel(q)]))
+		}
+		row = append(row, csvFloat(stats.Max))
+	}
+	return row
+}
+
+// formats a number of the csv results, which all have the same precision
+func csvFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+// writes the header row to the writer, and adds it to the writers of the csv results
+func addCsvWriter(w io.Writer) {
+	writer := csv.NewWriter(w)
+	_ = writer.Write(csvHeader())
+	writer.Flush()
+	csvWriters = append(csvWriters, writer)
+}
+
+// creates the local csv file, if the csv argument is set
+func openCsvFile() {
+	if csvFile == "" {
+		return
+	}
+
+	f, err := os.Create(csvFile)
+	if err != nil {
+		panic("Failed to create the csv file: " + err.Error())
+	}
+	csvFileCloser = f
+	addCsvWriter(f)
+}
+
+// writes the rows to all the writers of the csv results, and flushes them so that they can be read while the benchmark
+// is running
+func writeCsvRows(rows [][]string) {
+	for _, w := range csvWriters {
+		_ = w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			panic("Failed to write the csv results: " + err.Error())
+		}
+	}
+	if output != nil && outputFormat == "csv" {
+		_ = output.Flush()
+	}
+}
+
+// closes the local csv file
+func closeCsvFile() {
+	if csvFileCloser == nil {
+		return
+	}
+
+	_ = csvFileCloser.Close()
+	fmt.Fprintf(console, "CSV results written to \033[1;33m%s\033[0m\n", csvFile)
+}
+
+// uploads the csv records to S3, with a header row, using the key prefix argument and the instance type as the key
+func uploadCsvResults(csvRecords [][]string) {
+	b := &bytes.Buffer{}
+	w := csv.NewWriter(b)
+	_ = w.Write(csvHeader())
+	_ = w.WriteAll(csvRecords)
+
+	// create the s3 key based on the prefix argument and instance type
+	key := "results/" + csvResults + "-" + instanceType
+	if run.Scenario != "" {
+		key += "-" + run.Scenario
+	}
+
+	// do the PutObject request
+	err := store.PutObject(context.Background(), bucketName, key, bytes.NewReader(b.Bytes()))
+
+	// if the request fails, exit
+	if err != nil {
+		panic("Failed to put object: " + err.Error())
+	}
+
+	fmt.Fprintf(console, "CSV results uploaded to \033[1;33ms3://%s/%s\033[0m\n", bucketName, key)
+}
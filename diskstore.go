@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// an object store that keeps the objects in files, with a directory for every bucket and a file for every object,
+// whose name is the escaped key, so that keys with slashes don't need directories
+type diskStore struct {
+	dir string
+
+	// the lock of the ids of the multipart uploads
+	lock   sync.Mutex
+	nextID int
+}
+
+// the directories of the multipart uploads and of the files being written, which can't be buckets since bucket names
+// don't start with a dot
+const diskUploadsDir = ".uploads"
+const diskTempDir = ".tmp"
+
+// returns a store of the objects in the directory, which is created if it doesn't exist
+func newDiskStore(dir string) *diskStore {
+	for _, d := range []string{dir, filepath.Join(dir, diskUploadsDir), filepath.Join(dir, diskTempDir)} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			panic("Failed to create the directory of the objects: " + err.Error())
+		}
+	}
+	return &diskStore{dir: dir}
+}
+
+// returns the directory of the bucket, if it exists
+func (s *diskStore) bucket(bucket string) (string, error) {
+	dir := filepath.Join(s.dir, url.PathEscape(bucket))
+	if strings.HasPrefix(bucket, ".") || bucket == "" {
+		return "", errNoSuchBucket()
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", errNoSuchBucket()
+	}
+	return dir, nil
+}
+
+// returns the file of the object, whether it exists or not
+func (s *diskStore) object(bucket string, key string) (string, error) {
+	dir, err := s.bucket(bucket)
+	if err != nil {
+		return "", err
+	}
+
+	// the dot files would be the directory itself or its parent
+	if key == "" || key == "." || key == ".." {
+		return "", &storeError{"InvalidArgument", "Invalid key", 400}
+	}
+	return filepath.Join(dir, url.PathEscape(key)), nil
+}
+
+// writes the content to a temporary file, and moves it to the given file once it's complete, so that readers never
+// see a partial object, and returns the ETag of the content
+func (s *diskStore) writeFile(file string, content io.Reader) (string, error) {
+	temp, err := ioutil.TempFile(filepath.Join(s.dir, diskTempDir), "object")
+	if err != nil {
+		return "", err
+	}
+
+	digest := md5.New()
+	_, err = io.Copy(io.MultiWriter(temp, digest), content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		return "", err
+	}
+	return etag(digest), nil
+}
+
+// returns the ETag of the content written to the digest, which is its quoted MD5 hash
+func etag(digest hash.Hash) string {
+	return fmt.Sprintf("\"%x\"", digest.Sum(nil))
+}
+
+// returns the error of a missing file as the given error of the store, or else the error itself
+func notExist(err error, missing func() error) error {
+	if os.IsNotExist(err) {
+		return missing()
+	}
+	return err
+}
+
+func (s *diskStore) CreateBucket(ctx context.Context, bucket string, region string) error {
+	if bucket == "" || strings.HasPrefix(bucket, ".") {
+		return &storeError{"InvalidBucketName", "The specified bucket is not valid.", 400}
+	}
+
+	err := os.Mkdir(filepath.Join(s.dir, url.PathEscape(bucket)), 0755)
+	if os.IsExist(err) {
+		return errBucketAlreadyOwnedByYou()
+	}
+	return err
+}
+
+func (s *diskStore) GetObject(ctx context.Context, bucket string, key string, byteRange string) (io.ReadCloser, error) {
+	file, err := s.object(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, notExist(err, errNotFound)
+	}
+	if byteRange == "" {
+		return f, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	start, end, ok := parseByteRange(byteRange, int(info.Size()))
+	if !ok {
+		_ = f.Close()
+		return nil, errInvalidRange()
+	}
+
+	// read the range of the file, and close the file when the range is closed
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, int64(start), int64(end-start)), f}, nil
+}
+
+func (s *diskStore) PutObject(ctx context.Context, bucket string, key string, body io.Reader) error {
+	file, err := s.object(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.writeFile(file, body)
+	return err
+}
+
+func (s *diskStore) HeadObject(ctx context.Context, bucket string, key string) (int64, error) {
+	file, err := s.object(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, notExist(err, errNotFound)
+	}
+	return info.Size(), nil
+}
+
+func (s *diskStore) CopyObject(ctx context.Context, bucket string, source string, destination string) error {
+	from, err := s.object(bucket, source)
+	if err != nil {
+		return err
+	}
+	to, err := s.object(bucket, destination)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(from)
+	if err != nil {
+		return notExist(err, errNotFound)
+	}
+	defer f.Close()
+
+	_, err = s.writeFile(to, f)
+	return err
+}
+
+func (s *diskStore) DeleteObject(ctx context.Context, bucket string, key string) error {
+	return s.DeleteObjects(ctx, bucket, []string{key})
+}
+
+func (s *diskStore) DeleteObjects(ctx context.Context, bucket string, keys []string) error {
+	for _, key := range keys {
+		file, err := s.object(bucket, key)
+		if err != nil {
+			return err
+		}
+
+		// like S3, deleting an object that doesn't exist succeeds
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *diskStore) ListObjects(ctx context.Context, bucket string, prefix string, maxKeys int, token *string) ([]string, *string, error) {
+	dir, err := s.bucket(bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	for _, name := range names {
+		key, err := url.PathUnescape(name.Name())
+		if err != nil {
+			continue
+		}
+
+		// the continuation token is the last key of the previous page
+		if strings.HasPrefix(key, prefix) && (token == nil || key > *token) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	if len(keys) <= maxKeys {
+		return keys, nil, nil
+	}
+	keys = keys[:maxKeys]
+	next := keys[len(keys)-1]
+	return keys, &next, nil
+}
+
+// returns the directory of the parts of the multipart upload of the object, if the upload exists
+func (s *diskStore) upload(bucket string, key string, uploadID string) (string, error) {
+	if _, err := strconv.Atoi(uploadID); err != nil {
+		return "", errNoSuchUpload()
+	}
+
+	dir := filepath.Join(s.dir, diskUploadsDir, uploadID)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "key"))
+	if err != nil || string(content) != bucket+"/"+key {
+		return "", errNoSuchUpload()
+	}
+	return dir, nil
+}
+
+func (s *diskStore) CreateMultipartUpload(ctx context.Context, bucket string, key string) (string, error) {
+	if _, err := s.object(bucket, key); err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.lock.Unlock()
+
+	// the directory of the parts remembers the object of the upload
+	dir := filepath.Join(s.dir, diskUploadsDir, id)
+	_ = os.RemoveAll(dir)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "key"), []byte(bucket+"/"+key), 0644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *diskStore) UploadPart(ctx context.Context, bucket string, key string, uploadID string, partNumber int, body io.Reader) (string, error) {
+	dir, err := s.upload(bucket, key, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	return s.writeFile(filepath.Join(dir, strconv.Itoa(partNumber)), body)
+}
+
+func (s *diskStore) CompleteMultipartUpload(ctx context.Context, bucket string, key string, uploadID string, etags []string) error {
+	dir, err := s.upload(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	file, err := s.object(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	// check the parts before they are joined
+	var parts []io.Reader
+	for i, tag := range etags {
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(i+1)))
+		if err != nil {
+			return errInvalidPart()
+		}
+		defer f.Close()
+
+		digest := md5.New()
+		if _, err := io.Copy(digest, f); err != nil {
+			return err
+		}
+		if etag(digest) != tag {
+			return errInvalidPart()
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		parts = append(parts, f)
+	}
+
+	if _, err := s.writeFile(file, io.MultiReader(parts...)); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *diskStore) AbortMultipartUpload(ctx context.Context, bucket string, key string, uploadID string) error {
+	dir, err := s.upload(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
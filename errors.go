@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+// the classes of the errors of failed requests, in the order of the results columns
+var errorClasses = []string{"throttle", "5xx", "timeout", "reset", "checksum", "other"}
+
+// the number of times a failed request is retried before it counts as an error
+var retries int
+
+// the wait before the first retry of a failed request, which doubles with every retry
+var retryBackoff time.Duration
+
+// whether a test in which all the requests failed stops the benchmark, instead of being reported with 100% errors
+var failFast bool
+
+// the error of a response body that doesn't match the object or range that was requested, in its size or content
+var errChecksum = errors.New("the response body doesn't match the object")
+
+// a failed S3 request, which the benchmarks return so that the thread that runs the request can count and retry it
+type requestError struct {
+	message string
+	class   string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// the errors of the requests of one test, by class
+type errorCounts struct {
+	classes map[string]uint64
+	retries uint64
+
+	// the last failed request, to explain why a test has no results at all
+	last *requestError
+}
+
+// the number of requests of the setup or cleanup that failed even after retrying, and the last of them
+var setupFailures int
+var setupError *requestError
+
+// returns the error of a failed request, which is classified for the results
+func failRequest(message string, err error) error {
+	return &requestError{message: message + ": " + err.Error(), class: classifyError(err)}
+}
+
+// returns the error of a failed request as a request error, and classifies it if it isn't one yet
+func asRequestError(err error) *requestError {
+	var failure *requestError
+	if errors.As(err, &failure) {
+		return failure
+	}
+	return &requestError{message: err.Error(), class: classifyError(err)}
+}
+
+// returns the class of the error of a failed request, which is either of the error classes
+func classifyError(err error) string {
+	message := err.Error()
+
+	// the SDK errors have the error code of S3 and the status code in their message
+	switch {
+	case errors.Is(err, errChecksum):
+		return "checksum"
+	case strings.Contains(message, "SlowDown") || strings.Contains(message, "status code: 503") ||
+		strings.Contains(message, "Throttl") || strings.Contains(message, "RequestLimitExceeded"):
+		return "throttle"
+	case strings.Contains(message, "status code: 5"):
+		return "5xx"
+	}
+
+	var netErr net.Error
+	if (errors.As(err, &netErr) && netErr.Timeout()) || strings.Contains(message, "Timeout") ||
+		strings.Contains(message, "timeout") || strings.Contains(message, "deadline exceeded") {
+		return "timeout"
+	}
+
+	if strings.Contains(message, "connection reset") || strings.Contains(message, "broken pipe") ||
+		strings.Contains(message, "unexpected EOF") || strings.HasSuffix(message, ": EOF") {
+		return "reset"
+	}
+
+	return "other"
+}
+
+// runs a request, and retries it with an exponential backoff with jitter as long as it fails with a transient error,
+// up to the retries argument, and returns the error of the last try, if it failed, and the number of retries
+func tryRequest(request func() error) (*requestError, int) {
+	backoff := retryBackoff
+	for retried := 0; ; retried++ {
+		err := request()
+		if err == nil {
+			return nil, retried
+		}
+
+		// requests that fail for good, e.g. because the object doesn't exist, aren't retried
+		failure := asRequestError(err)
+		if failure.class == "other" || retried >= retries {
+			return failure, retried
+		}
+
+		// wait for a random time up to the backoff, so that the threads don't all retry at the same time
+		if backoff > 0 {
+			time.Sleep(time.Duration(rand.Int63n(int64(backoff))) + 1)
+		}
+		backoff *= 2
+	}
+}
+
+// does a request of the setup or cleanup with retries, and counts it instead of exiting if it keeps failing, so that a
+// few failed uploads or deletes don't end a long benchmark run, and returns whether it succeeded
+func setupRequest(request func() error) bool {
+	failure, _ := tryRequest(request)
+	if failure != nil {
+		setupFailures++
+		setupError = failure
+	}
+	return failure == nil
+}
+
+// the preparations of the requests of one thread, which aren't part of the measurement
+type preparation struct {
+	time     time.Duration
+	failures int
+	last     *requestError
+}
+
+// prepares a request with retries, and counts the time it took and whether it kept failing, and returns whether it
+// succeeded
+func (p *preparation) prepare(request func() error) bool {
+	start := time.Now()
+	failure, _ := tryRequest(request)
+	p.time += time.Now().Sub(start)
+
+	if failure != nil {
+		p.failures++
+		p.last = failure
+	}
+	return failure == nil
+}
+
+// returns the average time that the threads of a test spent preparing their requests, and counts the preparations that
+// failed like the requests of the setup
+func preparationTime(prepared []preparation) time.Duration {
+	var total time.Duration
+	for _, p := range prepared {
+		total += p.time
+		if p.failures > 0 {
+			setupFailures += p.failures
+			setupError = p.last
+		}
+	}
+	if len(prepared) == 0 {
+		return 0
+	}
+	return total / time.Duration(len(prepared))
+}
+
+// prints how many requests of the setup or cleanup failed, if any, and resets the count
+func printSetupFailures(action string) {
+	if setupFailures == 0 {
+		return
+	}
+
+	fmt.Fprintf(console, "\033[1;31mFailed to %s %d objects\033[0m, the last with: %s\n", action, setupFailures, setupError.message)
+	setupFailures = 0
+	setupError = nil
+}
+
+// returns the first failure of the requests of an object that is transferred in parts, if any, along with the retries
+// of all the requests
+func partsFailure(parts []latency) (*requestError, int) {
+	var failure *requestError
+	retried := 0
+	for _, part := range parts {
+		if failure == nil {
+			failure = part.Failure
+		}
+		retried += part.Retries
+	}
+	return failure, retried
+}
+
+// adds the retries of a request to the counts, and its error if it failed
+func (c *errorCounts) record(timing latency) {
+	c.retries += uint64(timing.Retries)
+	if timing.Failure == nil {
+		return
+	}
+
+	if c.classes == nil {
+		c.classes = make(map[string]uint64)
+	}
+	c.classes[timing.Failure.class]++
+	c.last = timing.Failure
+}
+
+// returns the number of failed requests
+func (c errorCounts) total() uint64 {
+	total := uint64(0)
+	for _, count := range c.classes {
+		total += count
+	}
+	return total
+}
+
+// returns the failed requests in percent of all the requests, given the number of the requests that succeeded
+func (c errorCounts) percent(samples int) float64 {
+	total := c.total()
+	if total == 0 {
+		return 0
+	}
+	return float64(total) / float64(total+uint64(samples)) * 100
+}
+
+// panics with the error of the last failed request if all the requests of a test failed and the fail-fast argument is
+// set, since there's nothing to measure then, which is most likely a mistake in the arguments, e.g. a missing permission
+func (c errorCounts) checkSamples(samples int) {
+	if failFast && samples == 0 && c.last != nil {
+		panic("All the requests failed, the last with: " + c.last.message)
+	}
+}
+
+// prints the error of the last failed request below the results if all the requests of a test failed, which are
+// reported with 100% errors and no latencies
+func (c errorCounts) printAllFailed(samples int) {
+	if samples == 0 && c.last != nil {
+		fmt.Fprintf(console, "\033[1;31mAll the requests failed\033[0m, the last with: %s\n", c.last.message)
+	}
+}
+
+// sets the error columns of the results
+func (r *result) setErrors(c errorCounts) {
+	r.Errors = c.total()
+	r.ErrorPercent = c.percent(r.Samples)
+	r.ErrorClasses = c.classes
+	r.Retries = c.retries
+}
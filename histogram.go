@@ -0,0 +1,157 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// the number of linear sub-buckets of every power of two range of the histogram, which bounds the relative error of
+// the recorded values to 1/histogramHalfBuckets (about 0.1%)
+const histogramSubBuckets = 2048
+const histogramHalfBuckets = histogramSubBuckets / 2
+
+// a high dynamic range histogram of latencies, which records any number of values in a constant amount of memory and
+// with a bounded relative error, similar to HdrHistogram
+type histogram struct {
+	counts []uint64
+	count  uint64
+	min    time.Duration
+	max    time.Duration
+
+	// the running mean and sum of squared differences from the mean, in nanoseconds (Welford's algorithm)
+	mean float64
+	m2   float64
+}
+
+// summary statistics of some latencies in milliseconds, with the percentiles in the order of the percentiles argument
+type summary struct {
+	count       uint64
+	avg         float64
+	stddev      float64
+	min         float64
+	max         float64
+	percentiles []float64
+}
+
+// adds a latency to the histogram
+func (h *histogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	// grow the buckets as needed, so that histograms of short latencies stay small
+	i := histogramIndex(uint64(d))
+	if i >= len(h.counts) {
+		grown := make([]uint64, i+1)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[i]++
+
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+
+	h.count++
+	delta := float64(d) - h.mean
+	h.mean += delta / float64(h.count)
+	h.m2 += delta * (float64(d) - h.mean)
+}
+
+// returns the latency below or at which the given fraction of the recorded latencies are, using the nearest-rank
+// method, so that the result is always one of the recorded latencies (within the precision of the histogram)
+func (h *histogram) percentile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	// the rank of the latency, from 1 to the number of latencies
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > h.count {
+		rank = h.count
+	}
+
+	// the histogram only knows the bucket of a latency, but the exact min and max are known
+	if rank == 1 {
+		return h.min
+	}
+	if rank == h.count {
+		return h.max
+	}
+
+	seen := uint64(0)
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			// the middle of the bucket can be outside of the recorded latencies
+			d := time.Duration(histogramValue(i))
+			if d < h.min {
+				d = h.min
+			}
+			if d > h.max {
+				d = h.max
+			}
+			return d
+		}
+	}
+
+	return h.max
+}
+
+// returns the standard deviation of the recorded latencies
+func (h *histogram) stddev() time.Duration {
+	if h.count < 2 {
+		return 0
+	}
+	return time.Duration(math.Sqrt(h.m2 / float64(h.count)))
+}
+
+// calculates the summary statistics of the recorded latencies, in milliseconds
+func (h *histogram) summary() summary {
+	s := summary{
+		count:  h.count,
+		avg:    h.mean / 1000000,
+		stddev: milliseconds(h.stddev()),
+		min:    milliseconds(h.min),
+		max:    milliseconds(h.max),
+	}
+	for _, q := range percentiles {
+		s.percentiles = append(s.percentiles, milliseconds(h.percentile(q/100)))
+	}
+	return s
+}
+
+// returns the index of the bucket of the given value, where the values below the number of sub-buckets have a bucket
+// each, and every following power of two range is split into half as many linear buckets
+func histogramIndex(v uint64) int {
+	if v < histogramSubBuckets {
+		return int(v)
+	}
+
+	// the shift that brings the value into the upper half of the sub-buckets
+	shift := bits.Len64(v) - bits.Len64(histogramSubBuckets-1)
+	return histogramSubBuckets + (shift-1)*histogramHalfBuckets + int(v>>uint(shift)) - histogramHalfBuckets
+}
+
+// returns the middle of the range of values of the bucket with the given index
+func histogramValue(i int) uint64 {
+	if i < histogramSubBuckets {
+		return uint64(i)
+	}
+
+	shift := uint((i-histogramSubBuckets)/histogramHalfBuckets + 1)
+	sub := uint64((i-histogramSubBuckets)%histogramHalfBuckets + histogramHalfBuckets)
+	return sub<<shift + (uint64(1)<<shift)/2
+}
+
+// converts a duration to milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1000000
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestHistogramNearestRank(t *testing.T) {
+	tests := []struct {
+		values   []time.Duration
+		q        float64
+		expected time.Duration
+	}{
+		// a single sample is every percentile
+		{[]time.Duration{100}, 0, 100},
+		{[]time.Duration{100}, 0.5, 100},
+		{[]time.Duration{100}, 1, 100},
+
+		// with 2 samples, the median is the lower one, and anything above it the higher one
+		{[]time.Duration{200, 100}, 0, 100},
+		{[]time.Duration{200, 100}, 0.5, 100},
+		{[]time.Duration{200, 100}, 0.51, 200},
+		{[]time.Duration{200, 100}, 1, 200},
+
+		// with 3 samples, every third of the ranks is one sample
+		{[]time.Duration{300, 100, 200}, 0.33, 100},
+		{[]time.Duration{300, 100, 200}, 0.34, 200},
+		{[]time.Duration{300, 100, 200}, 0.5, 200},
+		{[]time.Duration{300, 100, 200}, 0.67, 300},
+		{[]time.Duration{300, 100, 200}, 0.99, 300},
+
+		// p0 and p100 are the exact min and max, even where the buckets are wider than one value
+		{[]time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}, 0, 10 * time.Millisecond},
+		{[]time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}, 1, 30 * time.Millisecond},
+	}
+	for _, test := range tests {
+		var h histogram
+		for _, v := range test.values {
+			h.record(v)
+		}
+		if got := h.percentile(test.q); got != test.expected {
+			t.Errorf("p%g of %v: expected %v, got %v", test.q*100, test.values, test.expected, got)
+		}
+	}
+
+	var empty histogram
+	if got := empty.percentile(0.5); got != 0 {
+		t.Errorf("Expected 0 for an empty histogram, got %v", got)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	tests := []struct {
+		value uint64
+		index int
+	}{
+		// every value below the sub-buckets has a bucket of its own
+		{0, 0},
+		{2047, 2047},
+
+		// the next power of two range has buckets of 2 values, and the one after of 4
+		{2048, 2048},
+		{2049, 2048},
+		{2050, 2049},
+		{4095, 3071},
+		{4096, 3072},
+		{4099, 3072},
+		{4100, 3073},
+	}
+	for _, test := range tests {
+		if got := histogramIndex(test.value); got != test.index {
+			t.Errorf("Expected %d in bucket %d, got %d", test.value, test.index, got)
+		}
+	}
+
+	// the buckets are contiguous, and the value of every bucket is in the bucket
+	previous := 0
+	for v := uint64(1); v < 20000; v++ {
+		i := histogramIndex(v)
+		if i != previous && i != previous+1 {
+			t.Fatalf("Expected %d in bucket %d or %d, got %d", v, previous, previous+1, i)
+		}
+		previous = i
+		if got := histogramIndex(histogramValue(i)); got != i {
+			t.Fatalf("Expected the value of bucket %d to be in it, got bucket %d", i, got)
+		}
+	}
+}
+
+func TestHistogramRelativeError(t *testing.T) {
+	values := []uint64{1, 2047, 2048, 2049, 4095, 4096, 1<<20 - 1, 1 << 20, 1<<40 + 12345, math.MaxInt64}
+	for i := 0; i < 10000; i++ {
+		values = append(values, uint64(rand.Int63n(int64(time.Minute))))
+	}
+
+	for _, v := range values {
+		got := histogramValue(histogramIndex(v))
+		if e := math.Abs(float64(got)-float64(v)) / float64(v); v > 0 && e > 1.0/histogramHalfBuckets {
+			t.Fatalf("Expected %d within 0.1%%, got %d, an error of %g", v, got, e)
+		}
+	}
+}
+
+func TestHistogramLargeValues(t *testing.T) {
+	// there's no top bucket, so even the largest duration is recorded
+	var h histogram
+	h.record(time.Second)
+	h.record(time.Duration(math.MaxInt64))
+
+	if got := h.percentile(1); got != time.Duration(math.MaxInt64) {
+		t.Fatalf("Expected the max of %v, got %v", time.Duration(math.MaxInt64), got)
+	}
+	if got := h.percentile(0.5); got != time.Second {
+		t.Fatalf("Expected the median of 1s, got %v", got)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// the durations of the phases of an HTTP request, measured with httptrace
+type httpPhases struct {
+	// the DNS lookup, TCP connect and TLS handshake, which are zero if the connection was reused
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+
+	// from having written the request to getting the first byte of the response, which is the S3 service latency
+	// plus a network round trip
+	Wait time.Duration
+
+	// from getting the first byte of the response to getting the last byte
+	Body time.Duration
+
+	// whether the request used a connection from the connection pool
+	Reused bool
+}
+
+// the names of the phases of an HTTP request, in the order of the phases table
+var httpPhaseNames = []string{"DNS", "Connect", "TLS", "Wait", "Body"}
+
+// the results table of the phases of the HTTP requests
+var phasesTable = table{columns: []string{" Threads ", "  Phase  ", "  Count ", " Reused "}, statsColumns: 1}
+
+// collects the timestamps of the phases of an HTTP request, which are reported from different goroutines
+type requestTrace struct {
+	lock         sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+	reused       bool
+}
+
+// the latencies of the phases of the HTTP requests of one benchmark record
+type phasesRecord struct {
+	threads  int
+	requests int
+	reused   int
+	phases   map[string]*histogram
+}
+
+// the phases of the HTTP requests of every thread count of the current object size, printed after its results
+var phasesRecords []*phasesRecord
+
+// returns the context of a request, which traces the phases of the HTTP request if the trace argument is set, along
+// with the trace, or else nil
+func traceRequest() (context.Context, *requestTrace) {
+	if !traceHTTP {
+		return context.Background(), nil
+	}
+
+	t := &requestTrace{}
+	now := func(field *time.Time) {
+		t.lock.Lock()
+		*field = time.Now()
+		t.lock.Unlock()
+	}
+
+	ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.lock.Lock()
+			t.reused = info.Reused
+			t.lock.Unlock()
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart:         func(string, string) { now(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { now(&t.connectDone) },
+		TLSHandshakeStart:    func() { now(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wroteRequest) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	})
+
+	return ctx, t
+}
+
+// adds the phases of the traced request to the latency result of a request that started at the given time, if the
+// request was traced
+func (t *requestTrace) finish(result latency, start time.Time) latency {
+	if t == nil {
+		return result
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// the time between two timestamps, if both phases happened
+	between := func(from time.Time, to time.Time) time.Duration {
+		if from.IsZero() || to.IsZero() || to.Before(from) {
+			return 0
+		}
+		return to.Sub(from)
+	}
+
+	result.Phases = &httpPhases{
+		DNS:     between(t.dnsStart, t.dnsDone),
+		Connect: between(t.connectStart, t.connectDone),
+		TLS:     between(t.tlsStart, t.tlsDone),
+		Wait:    between(t.wroteRequest, t.firstByte),
+		Body:    between(t.firstByte, start.Add(result.LastByte)),
+		Reused:  t.reused,
+	}
+	return result
+}
+
+// adds the phases of a request to the record, where the phases that didn't happen aren't counted
+func (r *phasesRecord) record(p *httpPhases) {
+	if r.phases == nil {
+		r.phases = make(map[string]*histogram)
+		for _, name := range httpPhaseNames {
+			r.phases[name] = &histogram{}
+		}
+	}
+
+	r.requests++
+	if p.Reused {
+		r.reused++
+	}
+
+	for i, d := range []time.Duration{p.DNS, p.Connect, p.TLS, p.Wait, p.Body} {
+		if d > 0 {
+			r.phases[httpPhaseNames[i]].record(d)
+		}
+	}
+}
+
+// prints the phases of the HTTP requests of every thread count that was tested, and forgets them
+func printPhases() {
+	if len(phasesRecords) == 0 {
+		return
+	}
+
+	fmt.Fprintln(console, "HTTP request phases")
+	phasesTable.printHeader("Duration (ms)")
+	for _, r := range phasesRecords {
+		for _, name := range httpPhaseNames {
+			h := r.phases[name]
+			if h == nil || h.count == 0 {
+				continue
+			}
+			fmt.Fprintf(console, "| %7d | %7s | %6d | %5.1f%% |%s|\n",
+				r.threads, name, h.count, 100*float64(r.reused)/float64(r.requests), statsColumn(h.summary()))
+		}
+	}
+	phasesTable.printFooter()
+
+	phasesRecords = nil
+}
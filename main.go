@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
-	"encoding/csv"
 	"flag"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -12,10 +12,12 @@ import (
 	"github.com/schollz/progressbar/v2"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"net/http"
 	"os"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,32 +25,149 @@ import (
 type latency struct {
 	FirstByte time.Duration
 	LastByte  time.Duration
-}
 
-// summary statistics used to summarize first byte and last byte latencies
-type stat int
+	// the S3 operation that was measured, only set by the mixed benchmark
+	Operation string
 
-const (
-	min stat = iota + 1
-	max
-	avg
-	p25
-	p50
-	p75
-	p90
-	p99
-)
+	// the bytes the request transferred if not the payload size, only set by the random range benchmark, whose ranges
+	// are capped to the size of the object
+	Bytes uint64
+
+	// the phases of the HTTP request, only set with the trace argument
+	Phases *httpPhases
+
+	// the error of the request if it failed even after retrying, and the number of retries
+	Failure *requestError
+	Retries int
+}
 
 // a benchmark record for one object size and thread count
 type benchmark struct {
 	objectSize uint64
 	threads    int
-	firstByte  map[stat]float64
-	lastByte   map[stat]float64
-	dataPoints []latency
+	samples    int
+	firstByte  summary
+	lastByte   summary
 }
 
-// absolute limits
+// describes how to run and present the results of one benchmark mode
+type benchmarkMode struct {
+	// the verb used in the title of the results table, e.g. "Download"
+	title string
+
+	// what the payload size refers to in the title of the results table, if not the size of the objects
+	payloadTitle string
+
+	// the column titles of the two latencies measured for every request
+	firstByteTitle string
+	lastByteTitle  string
+
+	// whether the benchmark reads the test objects, which then have to be uploaded during the setup
+	readsObjects bool
+
+	// whether the throughput is measured in requests per second instead of bytes per second
+	countsRequests bool
+
+	// whether the payload size has no effect on the benchmark, so that it only runs once for every thread count
+	payloadless bool
+
+	// performs a single timed S3 request for the given thread index and object size, and returns its error if it failed
+	run func(threadIndex int, payloadSize uint64) (latency, error)
+
+	// if set, prepares every request before it is sent, e.g. uploads the objects that it deletes, which counts neither
+	// for the latency of the request nor for the duration of the test
+	prepare func(threadIndex int, payloadSize uint64) error
+
+	// if set, uploads the objects read by the benchmark instead of one object per thread and object size
+	setup func()
+
+	// if set, runs the whole benchmark instead of the default sweep over object sizes and thread counts
+	sweep func()
+}
+
+// the benchmark modes that can be selected with the mode argument
+var benchmarkModes = map[string]benchmarkMode{
+	"get": {
+		title:          "Download",
+		firstByteTitle: "Time to First Byte (ms)",
+		lastByteTitle:  "Time to Last Byte (ms)",
+		readsObjects:   true,
+		run:            getObject,
+	},
+	"put": {
+		title:          "Upload",
+		firstByteTitle: "Time to Request Sent (ms)",
+		lastByteTitle:  "Time to Response (ms)",
+		run:            putObject,
+	},
+	"multipart": {
+		title:          "Multipart upload",
+		firstByteTitle: "Part Upload Time (ms)",
+		lastByteTitle:  "Complete Upload Time (ms)",
+		sweep:          runMultipartBenchmark,
+	},
+	"head": {
+		title:          "HeadObject",
+		firstByteTitle: "Time to First Byte (ms)",
+		lastByteTitle:  "Time to Last Byte (ms)",
+		readsObjects:   true,
+		countsRequests: true,
+		run:            headObject,
+	},
+	"list": {
+		title:          "ListObjectsV2",
+		firstByteTitle: "Time to First Byte (ms)",
+		lastByteTitle:  "Time to Last Byte (ms)",
+		countsRequests: true,
+		payloadless:    true,
+		run:            listObjects,
+		setup:          setupListObjects,
+	},
+	"delete": {
+		title:          "DeleteObject",
+		firstByteTitle: "Time to First Byte (ms)",
+		lastByteTitle:  "Time to Last Byte (ms)",
+		countsRequests: true,
+		run:            deleteObjects,
+		prepare:        uploadDeleteBatch,
+	},
+	"copy": {
+		title:          "CopyObject",
+		firstByteTitle: "Time to First Byte (ms)",
+		lastByteTitle:  "Time to Last Byte (ms)",
+		readsObjects:   true,
+		run:            copyObject,
+	},
+	"mixed": {
+		title:          "Mixed workload",
+		firstByteTitle: "Time to First Byte (ms)",
+		lastByteTitle:  "Time to Last Byte (ms)",
+		readsObjects:   true,
+		run:            mixedOperation,
+	},
+	"random-range": {
+		title:          "Random range read",
+		payloadTitle:   "ranges",
+		firstByteTitle: "Time to First Byte (ms)",
+		lastByteTitle:  "Time to Last Byte (ms)",
+		run:            getRandomRange,
+		setup:          setupRandomRange,
+	},
+	"ranged": {
+		title:          "Ranged download",
+		firstByteTitle: "Range Time to First Byte (ms)",
+		lastByteTitle:  "Object Time to Last Byte (ms)",
+		readsObjects:   true,
+		sweep:          runRangedBenchmark,
+	},
+}
+
+// the maximum number of requests that can wait for a free thread when sending requests at a fixed rate, after which
+// the requests are sent late, but their latencies are still measured from the time they were meant to be sent
+const openLoopQueueSize = 100000
+
+// the object sizes and thread counts that cleanup always covers, which are the power of two object sizes up to 128 MB
+// and 64 threads, or more if the arguments test more threads
 const maxPayload = 18
 const maxThreads = 64
 
@@ -59,8 +178,9 @@ const bucketNamePrefix = "s3-benchmark"
 // the hostname or EC2 instance id
 var hostname = getHostname()
 
-// the EC2 instance region if available
-var region = getRegion()
+// the EC2 instance region if available, which is the region unless the region argument is set
+var instanceRegion = getRegion()
+var region = instanceRegion
 
 // the endpoint URL if applicable
 var endpoint string
@@ -69,20 +189,43 @@ var endpoint string
 var instanceType = getInstanceType()
 
 // the script will automatically create an S3 bucket to use for the test, and it tries to get a unique bucket name
-// by generating a sha hash of the hostname
-var bucketName = fmt.Sprintf("%s-%x", bucketNamePrefix, sha1.Sum([]byte(hostname)))
+// by generating a sha hash of the hostname, unless the bucket-name argument is set
+var hostBucketName = fmt.Sprintf("%s-%x", bucketNamePrefix, sha1.Sum([]byte(hostname)))
+var bucketName = hostBucketName
 
 // the min and max object sizes to test - 1 = 1 KB, and the size doubles with every increment
 var payloadsMin int
 var payloadsMax int
 
+// the object sizes to test in bytes, from the sizes argument or else from the min and max object sizes
+var payloadSizes []uint64
+
+// flag to trace the phases of the HTTP requests, and print their latencies after the results
+var traceHTTP bool
+
+// the percentiles of the latencies to summarize, from 0 to 100
+var percentiles []float64
+
 // the min and max thread count to use in the test
 var threadsMin int
 var threadsMax int
 
+// the thread counts to test, from the threads argument or else every thread count from the min to the max
+var threadCounts []int
+
 // the number of samples to collect for each benchmark record
 var samples int
 
+// if not zero, the requests are sent at this fixed rate in requests or bytes per second regardless of whether
+// previous requests finished, and the latencies are measured from the time each request was meant to be sent
+var requestRate float64
+var requestRateBytes float64
+
+// if not zero, every benchmark record collects samples for this duration or until this many bytes were transferred,
+// instead of collecting a fixed number of samples
+var testDuration time.Duration
+var targetBytes uint64
+
 // a test mode to find out when EC2 network throttling kicks in
 var throttlingMode bool
 
@@ -92,16 +235,71 @@ var cleanupOnly bool
 // if not empty, the results of the test get uploaded to S3 using this key prefix
 var csvResults string
 
+// if not empty, the results of the test get written to this local csv file as the benchmark runs
+var csvFile string
+
 // flag to create the s3 bucket
 var createBucket bool
 
-// the S3 SDK client
-var s3Client *s3.S3
+// the benchmark mode, which selects the S3 operation to measure
+var mode string
+
+// the size in bytes of the object read at random offsets by the random range benchmark
+var rangeObjectSize uint64
+
+// the maximum number of keys per ListObjectsV2 request, and the number of prefixes and objects per prefix listed by
+// the list benchmark
+var listPageSize int
+var listPrefixes int
+var listObjectCount int
+
+// the weights of the operations of the mixed benchmark, in the same order as mixedOperations
+var mixWeights []int
+
+// the seed of the random offsets of the random range benchmark and the random operations of the mixed benchmark
+var randomSeed int64
+
+// the number of objects deleted by every request of the delete benchmark
+var deleteBatch int
+
+// the min and max part sizes in bytes, and the min and max number of parts transferred in parallel for each object,
+// used by the benchmarks that split objects into parts
+var partSizeMin uint64
+var partSizeMax uint64
+var partThreadsMin int
+var partThreadsMax int
+
+// the subcommands that work on the results of previous benchmarks or serve a local S3 to benchmark, by name, which take
+// the arguments after their name and return the exit code
+var subcommands = map[string]func(args []string) int{
+	"compare": runCompare,
+	"report":  runReport,
+	"serve":   runServe,
+}
+
+// the AWS credentials profile to use, or empty for the default one
+var profile string
+
+// the prefix of the keys of all the objects uploaded by the benchmarks
+var keyPrefix string
 
 // program entry point
 func main() {
+	// run the subcommand instead of a benchmark, if the first argument is one
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(subcommand(os.Args[2:]))
+		}
+	}
+
 	// parse the program arguments and set the global variables
-	parseFlags()
+	parseFlags(os.Args[1:])
+
+	// run every scenario of the plan file instead, if there is one
+	if planFile != "" {
+		runPlan()
+		return
+	}
 
 	// set up the S3 SDK
 	setupS3Client()
@@ -112,54 +310,215 @@ func main() {
 		return
 	}
 
+	// open the structured results and record the metadata of this run
+	openOutput()
+	startRun("")
+
+	// serve the metrics of the requests while the benchmark is running
+	startMetricsServer()
+
+	// measure the ceiling of the client against a local server, if the calibrate argument is set
+	runCalibration()
+
 	// create the S3 bucket and upload the test data
 	setup()
 
 	// run the test against the uploaded data
-	runBenchmark()
+	if sweep := benchmarkModes[mode].sweep; sweep != nil {
+		sweep()
+	} else if saturationSearch {
+		runSaturationBenchmark()
+	} else {
+		runBenchmark()
+	}
 
 	// remove the objects uploaded to S3 for this test (but doesn't remove the bucket)
 	cleanup()
+
+	// write the structured results
+	closeOutput()
 }
 
-func parseFlags() {
+func parseFlags(args []string) {
+	// start from a new set of flags, so that the flags can be parsed again for every scenario of a plan file
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
 	threadsMinArg := flag.Int("threads-min", 8, "The minimum number of threads to use when fetching objects from S3.")
 	threadsMaxArg := flag.Int("threads-max", 16, "The maximum number of threads to use when fetching objects from S3.")
 	payloadsMinArg := flag.Int("payloads-min", 1, "The minimum object size to test, with 1 = 1 KB, and every increment is a double of the previous value.")
 	payloadsMaxArg := flag.Int("payloads-max", 10, "The maximum object size to test, with 1 = 1 KB, and every increment is a double of the previous value.")
-	samplesArg := flag.Int("samples", 1000, "The number of samples to collect for each test of a single object size and thread count.")
+	threadsArg := flag.String("threads", "", "The comma separated thread counts to test, which override the threads arguments, e.g. 1,2,4,8,16,64,256. A range of thread counts either multiplies (1..256*2) or adds (8..64+8) a step.")
+	sizesArg := flag.String("sizes", "", "The comma separated object sizes to test, which override the payloads arguments, e.g. 4KiB,100KB,8MiB,1GiB. A range of sizes either multiplies (1KiB..1MiB*4) or adds (10MB..100MB+10MB) a step.")
+	samplesArg := flag.Int("samples", 1000, "The number of samples to collect for each test of a single object size and thread count, which is capped on small instances and for low thread counts.")
+	durationArg := flag.Duration("duration", 0, "If set, collects samples for this duration (e.g. 60s) for each test of a single object size and thread count, instead of a fixed number of samples.")
+	targetMBArg := flag.Int("target-mb", 0, "If set, collects samples until this many MB were transferred for each test of a single object size and thread count, instead of a fixed number of samples.")
+	rateArg := flag.Float64("rate", 0, "If set, sends requests at this fixed rate per second regardless of whether previous requests finished, and measures latencies from the time each request was meant to be sent.")
+	rateMBArg := flag.Float64("rate-mb", 0, "If set, sends requests at a fixed rate that transfers this many MB per second, like the rate argument.")
+	percentilesArg := flag.String("percentiles", "25,50,75,90,99", "The comma separated percentiles of the latencies to summarize, e.g. 50,99,99.9,99.99.")
+	traceArg := flag.Bool("trace", false, "Traces the phases of the HTTP requests (DNS, connect, TLS, wait and body) and prints their latencies and the share of reused connections after the results.")
 	bucketNameArg := flag.String("bucket-name", "", "Cleans up all the S3 artifacts used by the benchmarks.")
 	regionArg := flag.String("region", "", "Sets the AWS region to use for the S3 bucket. Only applies if the bucket doesn't already exist.")
 	endpointArg := flag.String("endpoint", "", "Sets the S3 endpoint to use. Only applies to non-AWS, S3-compatible stores.")
 	fullArg := flag.Bool("full", false, "Runs the full exhaustive test, and overrides the threads and payload arguments.")
 	throttlingModeArg := flag.Bool("throttling-mode", false, "Runs a continuous test to find out when EC2 network throttling kicks in.")
 	cleanupArg := flag.Bool("cleanup", false, "Cleans all the objects uploaded to S3 for this test.")
-	csvResultsArg := flag.String("upload-csv", "", "Uploads the test results to S3 as a CSV file.")
+	csvResultsArg := flag.String("upload-csv", "", "Uploads the test results to S3 as a CSV file, under results/ with this key prefix.")
+	csvFileArg := flag.String("csv", "", "Writes the test results to this local CSV file as the benchmark runs.")
 	createBucketArg := flag.Bool("create-bucket", true, "Create the bucket")
-	
-	// parse the arguments and set all the global variables accordingly
-	flag.Parse()
-
-	if *bucketNameArg != "" {
-		bucketName = *bucketNameArg
+	modeArg := flag.String("mode", "get", "The S3 operation to benchmark: get (download), put (upload), multipart (multipart upload), ranged (parallel ranged download), random-range (small reads at random offsets of a large object), head, list, delete, copy, or mixed.")
+	mixArg := flag.String("mix", "70:20:10:0", "The weights of the get:put:head:delete operations in mixed mode.")
+	seedArg := flag.Int64("seed", 0, "The seed of the random offsets in random-range mode and of the random operations in mixed mode, to repeat the requests of a run, or 0 for a seed from the clock.")
+	listPageSizeArg := flag.Int("list-page-size", 1000, "The maximum number of keys returned by every ListObjectsV2 request in list mode.")
+	listPrefixesArg := flag.Int("list-prefixes", 1, "The number of key prefixes listed by the threads in list mode, where every thread lists one of them.")
+	listObjectsArg := flag.Int("list-objects", 1000, "The number of objects under every key prefix in list mode.")
+	deleteBatchArg := flag.Int("delete-batch", 1, "The number of objects deleted by every request in delete mode, where more than 1 uses DeleteObjects.")
+	rangeObjectSizeArg := flag.Int("range-object-size", 256, "The size in MB of the object read by random-range mode, where the payload sizes are the sizes of the ranges.")
+	partSizeMinArg := flag.Int("part-size-min", 8, "The minimum part or range size in MB to test in multipart and ranged mode, and every increment is a double of the previous value.")
+	partSizeMaxArg := flag.Int("part-size-max", 64, "The maximum part or range size in MB to test in multipart and ranged mode, and every increment is a double of the previous value.")
+	partThreadsMinArg := flag.Int("part-threads-min", 1, "The minimum number of parts or ranges of one object to transfer in parallel in multipart and ranged mode.")
+	partThreadsMaxArg := flag.Int("part-threads-max", 8, "The maximum number of parts or ranges of one object to transfer in parallel in multipart and ranged mode, and every increment is a double of the previous value.")
+	outputArg := flag.String("output", "table", "The format of the structured results: table (only the results tables), json (one document at the end), ndjson (one line per result as the benchmark runs), or csv.")
+	saturationArg := flag.Bool("saturation", false, "Searches for the thread count where the throughput stops growing for every object size, by doubling the threads and then bisecting, instead of testing every thread count. The search starts at 1 thread unless the threads-min argument is given, and the threads-max argument bounds it.")
+	saturationGainArg := flag.Float64("saturation-gain", 5, "The throughput gain in percent below which more threads don't count as an improvement in the saturation search.")
+	saturationLatencyArg := flag.Float64("saturation-latency", 2, "The factor by which the highest latency percentile may grow over the best thread count before the saturation search stops adding threads.")
+	planArg := flag.String("plan", "", "Runs the scenarios of this JSON plan file one after the other, where every scenario sets the arguments of one benchmark run.")
+	profileArg := flag.String("profile", "", "The AWS credentials profile to use, instead of the default one.")
+	keyPrefixArg := flag.String("key-prefix", "", "The prefix of the keys of all the objects uploaded by the benchmarks, e.g. bench/ to keep them under one folder.")
+	metricsAddressArg := flag.String("metrics-address", "", "If set, serves Prometheus metrics of the requests on this address (e.g. :9100) at /metrics while the benchmark is running.")
+	retriesArg := flag.Int("retries", 0, "The number of times a request that failed with a transient error (throttling, 5xx, timeout, connection reset or checksum mismatch) is retried with exponential backoff before it counts as an error. This is on top of the retries of the AWS SDK.")
+	retryBackoffArg := flag.Duration("retry-backoff", 100*time.Millisecond, "The maximum wait before the first retry of a failed request, which doubles with every retry.")
+	failFastArg := flag.Bool("fail-fast", false, "Stops the benchmark if all the requests of a test fail, instead of reporting the test with 100% errors and going on with the next one.")
+	calibrateArg := flag.Bool("calibrate", false, "Before the benchmark, runs the same tests with the highest thread count against an in-process S3 server without latency on the loopback interface, to measure the request rate and throughput this client can reach on its own for every object size.")
+	outputFileArg := flag.String("output-file", "-", "The file to write the structured results to, or - for stdout, in which case the results tables are printed to stderr.")
+
+	// parse the arguments and set all the global variables accordingly, including those of the arguments that aren't
+	// given, so that parsing the arguments of a scenario of a plan file doesn't keep those of the previous one
+	_ = flag.CommandLine.Parse(args)
+
+	bucketName = *bucketNameArg
+	if bucketName == "" {
+		bucketName = hostBucketName
 	}
 
-	if *regionArg != "" {
-		region = *regionArg
+	region = *regionArg
+	if region == "" {
+		region = instanceRegion
 	}
 
-	if *endpointArg != "" {
-		endpoint = *endpointArg
-	}
+	endpoint = *endpointArg
 
 	payloadsMin = *payloadsMinArg
 	payloadsMax = *payloadsMaxArg
 	threadsMin = *threadsMinArg
 	threadsMax = *threadsMaxArg
 	samples = *samplesArg
+	percentiles = parsePercentiles(*percentilesArg)
+	traceHTTP = *traceArg
+	testDuration = *durationArg
+	requestRate = *rateArg
+	requestRateBytes = *rateMBArg * 1024 * 1024
+	targetBytes = uint64(*targetMBArg) * 1024 * 1024
 	cleanupOnly = *cleanupArg
 	csvResults = *csvResultsArg
+	csvFile = *csvFileArg
 	createBucket = *createBucketArg
+	mode = *modeArg
+	outputFormat = *outputArg
+	outputFile = *outputFileArg
+	metricsAddress = *metricsAddressArg
+	planFile = *planArg
+	profile = *profileArg
+	keyPrefix = *keyPrefixArg
+	saturationSearch = *saturationArg
+
+	// the saturation search starts at 1 thread, so that it finds the knees below the default min threads, unless the
+	// threads-min argument is given
+	if saturationSearch {
+		threadsMin = 1
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "threads-min" {
+				threadsMin = *threadsMinArg
+			}
+		})
+	}
+	saturationGain = *saturationGainArg
+	saturationLatency = *saturationLatencyArg
+	retries = *retriesArg
+	retryBackoff = *retryBackoffArg
+	failFast = *failFastArg
+	calibrate = *calibrateArg
+
+	if outputFormat != "table" && outputFormat != "json" && outputFormat != "ndjson" && outputFormat != "csv" {
+		panic("Unknown output format: " + outputFormat)
+	}
+
+	if _, ok := benchmarkModes[mode]; !ok {
+		panic("Unknown benchmark mode: " + mode)
+	}
+
+	if (requestRate > 0 || requestRateBytes > 0) && benchmarkModes[mode].sweep != nil {
+		panic("The rate arguments don't apply to the " + mode + " mode")
+	}
+
+	if saturationSearch && benchmarkModes[mode].sweep != nil {
+		panic("The saturation search doesn't apply to the " + mode + " mode")
+	}
+
+	if calibrate && benchmarkModes[mode].sweep != nil {
+		panic("The calibration doesn't apply to the " + mode + " mode")
+	}
+
+	rangeObjectSize = uint64(*rangeObjectSizeArg) * 1024 * 1024
+	if rangeObjectSize == 0 {
+		panic("The range object size must be at least 1 MB")
+	}
+
+	mixWeights = parseMix(*mixArg)
+
+	// every run picks other offsets and operations, unless the seed argument is given
+	randomSeed = *seedArg
+	if randomSeed == 0 {
+		randomSeed = time.Now().UnixNano()
+	}
+	rand.Seed(randomSeed)
+	listPageSize = *listPageSizeArg
+	listPrefixes = *listPrefixesArg
+	listObjectCount = *listObjectsArg
+	deleteBatch = *deleteBatchArg
+
+	if listPrefixes < 1 {
+		listPrefixes = 1
+	}
+
+	// S3 deletes at most 1000 objects per DeleteObjects request
+	if deleteBatch < 1 || deleteBatch > 1000 {
+		panic("The delete batch size must be between 1 and 1000")
+	}
+	partSizeMin = uint64(*partSizeMinArg) * 1024 * 1024
+	partSizeMax = uint64(*partSizeMaxArg) * 1024 * 1024
+	partThreadsMin = *partThreadsMinArg
+	partThreadsMax = *partThreadsMaxArg
+
+	if partSizeMin > partSizeMax {
+		partSizeMin = partSizeMax
+	}
+
+	if partSizeMin == 0 {
+		panic("The minimum part size must be at least 1 MB")
+	}
+
+	if partThreadsMin < 1 {
+		partThreadsMin = 1
+	}
+
+	if partThreadsMin > partThreadsMax {
+		partThreadsMin = partThreadsMax
+	}
+
+	// S3 rejects multipart uploads with parts smaller than 5 MB (except for the last part)
+	if mode == "multipart" && partSizeMin < 5*1024*1024 {
+		panic("The minimum part size for multipart uploads is 5 MB")
+	}
 
 	if payloadsMin > payloadsMax {
 		payloadsMin = payloadsMax
@@ -177,19 +536,63 @@ func parseFlags() {
 		payloadsMax = 16 // 32 MB
 	}
 
-	if *throttlingModeArg {
+	throttlingMode = *throttlingModeArg
+	if throttlingMode {
 		// if running the network throttling test, the threads and payload arguments get overridden with these
 		threadsMin = 36
 		threadsMax = 36
 		payloadsMin = 15 // 16 MB
 		payloadsMax = 15 // 16 MB
-		throttlingMode = *throttlingModeArg
+	}
+
+	// the sizes argument replaces the payloads arguments, unless the full or throttling tests override them
+	payloadSizes = powerOfTwoSizes(payloadsMin, payloadsMax)
+	if *sizesArg != "" && !*fullArg && !*throttlingModeArg {
+		payloadSizes = parseSizes(*sizesArg)
+	}
+
+	// a range of no bytes has no valid Range header
+	for _, size := range payloadSizes {
+		if mode == "random-range" && size == 0 {
+			panic("The range sizes of the random-range mode must be at least 1 byte")
+		}
+	}
+
+	// the same goes for the threads argument, which also sets the min and max threads for the setup and cleanup
+	threadCounts = nil
+	for t := threadsMin; t <= threadsMax; t++ {
+		threadCounts = append(threadCounts, t)
+	}
+	if *threadsArg != "" && !*fullArg && !*throttlingModeArg {
+		threadCounts = parseThreadCounts(*threadsArg)
+		threadsMin, threadsMax = threadCounts[0], threadCounts[0]
+		for _, t := range threadCounts {
+			if t < threadsMin {
+				threadsMin = t
+			}
+			if t > threadsMax {
+				threadsMax = t
+			}
+		}
+	}
+
+	if saturationSearch && throttlingMode {
+		panic("The saturation search can't be combined with the throttling mode")
 	}
 }
 
 func setupS3Client() {
-	// gets the AWS credentials from the default file or from the EC2 instance profile
-	cfg, err := external.LoadDefaultAWSConfig()
+	store = newS3Store(endpoint)
+}
+
+// returns a store for S3 or the S3-compatible service at the given endpoint, if not empty
+func newS3Store(endpoint string) objectStore {
+	// gets the AWS credentials from the default file or from the EC2 instance profile, or from the profile argument
+	var configs []external.Config
+	if profile != "" {
+		configs = append(configs, external.WithSharedConfigProfile(profile))
+	}
+	cfg, err := external.LoadDefaultAWSConfig(configs...)
 	if err != nil {
 		panic("Unable to load AWS SDK config: " + err.Error())
 	}
@@ -208,292 +611,313 @@ func setupS3Client() {
 	}
 
 	// crete the S3 client
-	s3Client = s3.New(cfg)
+	client := s3.New(cfg)
 
 	// custom endpoints don't generally work with the bucket in the host prefix
 	if endpoint != "" {
-		s3Client.ForcePathStyle = true
+		client.ForcePathStyle = true
 	}
+
+	return &awsStore{client: client}
 }
 
 func setup() {
-	fmt.Print("\n--- \033[1;32mSETUP\033[0m --------------------------------------------------------------------------------------------------------------------\n\n")
+	fmt.Fprint(console, "\n--- \033[1;32mSETUP\033[0m --------------------------------------------------------------------------------------------------------------------\n\n")
 	if createBucket {
 		// try to create the S3 bucket
-		createBucketReq := s3Client.CreateBucketRequest(&s3.CreateBucketInput{
-			Bucket: aws.String(bucketName),
-			CreateBucketConfiguration: &s3.CreateBucketConfiguration{
-				LocationConstraint: s3.NormalizeBucketLocation(s3.BucketLocationConstraint(region)),
-			},
-		})
-
-		// AWS S3 has this peculiar issue in which if you want to create bucket in us-east-1 region, you should NOT specify 
-		// any location constraint. https://github.com/boto/boto3/issues/125
-		if strings.ToLower(region) == "us-east-1" {
-			createBucketReq = s3Client.CreateBucketRequest(&s3.CreateBucketInput{
-				Bucket: aws.String(bucketName),
-			})
-		}
-
-		_, err := createBucketReq.Send()
+		err := store.CreateBucket(context.Background(), bucketName, region)
 
 		// if the error is because the bucket already exists, ignore the error
 		if err != nil && !strings.Contains(err.Error(), "BucketAlreadyOwnedByYou:") {
 			panic("Failed to create S3 bucket: " + err.Error())
-		}	
+		}
 	}
 
-	// an object size iterator that starts from 1 KB and doubles the size on every iteration
-	generatePayload := payloadSizeGenerator()
+	setupObjects()
+}
+
+// uploads the objects that the benchmark reads
+func setupObjects() {
+	// some benchmarks read other objects than one per thread and object size
+	if prepare := benchmarkModes[mode].setup; prepare != nil {
+		prepare()
+		return
+	}
+
+	// the upload benchmarks create their own objects, so there's nothing to upload beforehand
+	if !benchmarkModes[mode].readsObjects {
+		return
+	}
 
 	// loop over every payload size
-	for p := 1; p <= payloadsMax; p++ {
-		// get an object size from the iterator
-		objectSize := generatePayload()
+	for _, objectSize := range payloadSizes {
+		fmt.Fprintf(console, "Uploading \033[1;33m%-s\033[0m objects\n", byteFormat(float64(objectSize)))
 
-		// ignore payloads smaller than the min argument
-		if p < payloadsMin {
-			continue
+		// the benchmarks that split objects into parts only read a single object per size
+		objectCount := threadsMax
+		if benchmarkModes[mode].sweep != nil {
+			objectCount = 1
 		}
 
-		fmt.Printf("Uploading \033[1;33m%-s\033[0m objects\n", byteFormat(float64(objectSize)))
-
 		// create a progress bar
-		bar := progressbar.NewOptions(threadsMax-1, progressbar.OptionSetRenderBlankState(true))
+		bar := progressbar.NewOptions(objectCount-1, progressbar.OptionSetRenderBlankState(true))
 
 		// create an object for every thread, so that different threads don't download the same object
-		for t := 1; t <= threadsMax; t++ {
+		for t := 1; t <= objectCount; t++ {
 			// increment the progress bar for each object
 			_ = bar.Add(1)
 
 			// generate an S3 key from the sha hash of the hostname, thread index, and object size
 			key := generateS3Key(hostname, t, objectSize)
 
-			// do a HeadObject request to avoid uploading the object if it already exists from a previous test run
-			headReq := s3Client.HeadObjectRequest(&s3.HeadObjectInput{
-				Bucket: aws.String(bucketName),
-				Key:    aws.String(key),
-			})
+			setupRequest(func() error { return uploadTestObject(key, objectSize) })
+		}
 
-			_, err := headReq.Send()
+		fmt.Fprint(console, "\n")
+	}
 
-			// if no error, then the object exists, so skip this one
-			if err == nil {
-				continue
-			}
+	// the objects that couldn't be uploaded fail the requests that read them, which count as errors
+	printSetupFailures("upload")
+}
 
-			// if other error, exit
-			if err != nil && !strings.Contains(err.Error(), "NotFound:") {
-				panic("Failed to head S3 object: " + err.Error())
-			}
+// uploads an empty object of the given size, unless it already exists from a previous test run
+func uploadTestObject(key string, objectSize uint64) error {
+	// do a HeadObject request to avoid uploading the object if it already exists from a previous test run
+	_, err := store.HeadObject(context.Background(), bucketName, key)
 
-			// generate empty payload
-			payload := make([]byte, objectSize)
+	// if no error, then the object exists, so skip this one
+	if err == nil {
+		return nil
+	}
 
-			// do a PutObject request to create the object
-			putReq := s3Client.PutObjectRequest(&s3.PutObjectInput{
-				Bucket: aws.String(bucketName),
-				Key:    aws.String(key),
-				Body:   bytes.NewReader(payload),
-			})
+	// if other error, fail
+	if err != nil && !strings.Contains(err.Error(), "NotFound:") {
+		return failRequest("Failed to head S3 object", err)
+	}
 
-			_, err = putReq.Send()
+	// generate empty payload
+	payload := zeroPayload(objectSize)
 
-			// if the put fails, exit
-			if err != nil {
-				panic("Failed to put S3 object: " + err.Error())
-			}
-		}
+	// do a PutObject request to create the object
+	err = store.PutObject(context.Background(), bucketName, key, bytes.NewReader(payload))
 
-		fmt.Print("\n")
+	// if the put fails, fail
+	if err != nil {
+		return failRequest("Failed to put S3 object", err)
 	}
+	return nil
 }
 
 func runBenchmark() {
-	fmt.Print("\n--- \033[1;32mBENCHMARK\033[0m ----------------------------------------------------------------------------------------------------------------\n\n")
+	fmt.Fprint(console, "\n--- \033[1;32mBENCHMARK\033[0m ----------------------------------------------------------------------------------------------------------------\n\n")
 
 	// array of csv records used to upload the results to S3 when the test is finished
 	var csvRecords [][]string
 
-	// an object size iterator that starts from 1 KB and doubles the size on every iteration
-	generatePayload := payloadSizeGenerator()
-
 	// loop over every payload size
-	for p := 1; p <= payloadsMax; p++ {
-		// get an object size from the iterator
-		payload := generatePayload()
-
-		// ignore payloads smaller than the min argument
-		if p < payloadsMin {
-			continue
-		}
-
+	for _, payload := range payloadSizes {
 		// print the header for the benchmark of this object size
 		printHeader(payload)
 
 		// run a test per thread count and object size combination
-		for t := threadsMin; t <= threadsMax; t++ {
+		for _, t := range threadCounts {
 			// if throttling mode, loop forever
 			for n := 1; true; n++ {
-				csvRecords = execTest(t, payload, n, csvRecords)
+				csvRecords, _ = execTest(benchmarkConfig(), t, payload, n, csvRecords)
 				if !throttlingMode {
 					break
 				}
 			}
 		}
-		fmt.Print("+---------+----------------+------------------------------------------------+------------------------------------------------+\n\n")
-	}
+		threadsTable.printFooter()
+		printCalibration(payload)
 
-	// if the csv option is true, upload the csv results to S3
-	if csvResults != "" {
-		b := &bytes.Buffer{}
-		w := csv.NewWriter(b)
-		_ = w.WriteAll(csvRecords)
-
-		// create the s3 key based on the prefix argument and instance type
-		key := "results/" + csvResults + "-" + instanceType
-
-		// do the PutObject request
-		putReq := s3Client.PutObjectRequest(&s3.PutObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    &key,
-			Body:   bytes.NewReader(b.Bytes()),
-		})
-
-		_, err := putReq.Send()
+		// print the phases of the HTTP requests, if they were traced
+		printPhases()
 
-		// if the request fails, exit
-		if err != nil {
-			panic("Failed to put object: " + err.Error())
+		// the payload size doesn't matter to some benchmarks, so they only need to run once
+		if benchmarkModes[mode].payloadless {
+			break
 		}
+	}
 
-		fmt.Printf("CSV results uploaded to \033[1;33ms3://%s/%s\033[0m\n", bucketName, key)
+	// if the csv option is true, upload the csv results to S3
+	if csvResults != "" {
+		uploadCsvResults(csvRecords)
 	}
 }
 
-func execTest(threadCount int, payloadSize uint64, runNumber int, csvRecords [][]string) [][]string {
+func execTest(config testConfig, threadCount int, payloadSize uint64, runNumber int, csvRecords [][]string) ([][]string, result) {
 	// this overrides the sample count on small hosts that can get overwhelmed by a large throughput
 	samples := getTargetSampleCount(threadCount, samples)
 
-	// a channel to submit the test tasks
-	testTasks := make(chan int, threadCount)
+	// a channel to submit the test tasks, which is unbuffered so that no tasks are queued up when a test ends, unless
+	// the requests are sent at a fixed rate, in which case the tasks queue up while all the threads are busy
+	testTasks := make(chan time.Time)
+	if requestRate > 0 || requestRateBytes > 0 {
+		testTasks = make(chan time.Time, openLoopQueueSize)
+	}
 
 	// a channel to receive results from the test tasks back on the main thread
-	results := make(chan latency, samples)
+	results := make(chan latency, threadCount)
+
+	// the operation to measure for every sample, and how to prepare it
+	run := benchmarkModes[mode].run
+	prepare := benchmarkModes[mode].prepare
+
+	// the time every thread spent preparing its requests, and the preparations that failed, indexed by thread - 1
+	prepared := make([]preparation, threadCount)
 
 	// create the workers for all the threads in this test
+	var workers sync.WaitGroup
 	for w := 1; w <= threadCount; w++ {
-		go func(o int, tasks <-chan int, results chan<- latency) {
-			for range tasks {
-				// generate an S3 key from the sha hash of the hostname, thread index, and object size
-				key := generateS3Key(hostname, o, payloadSize)
-
-				// start the timer to measure the first byte and last byte latencies
-				latencyTimer := time.Now()
-
-				// do the GetObject request
-				req := s3Client.GetObjectRequest(&s3.GetObjectInput{
-					Bucket: aws.String(bucketName),
-					Key:    aws.String(key),
+		workers.Add(1)
+		go func(o int, tasks <-chan time.Time, results chan<- latency) {
+			defer workers.Done()
+			for intended := range tasks {
+				// the time the task waited for a free thread after its intended send time, if it has one
+				var queued time.Duration
+				if !intended.IsZero() {
+					queued = time.Now().Sub(intended)
+				}
+
+				// prepare the request, and skip it if that fails, since the request itself can't be measured then
+				if prepare != nil && !prepared[o-1].prepare(func() error { return prepare(o, payloadSize) }) {
+					continue
+				}
+
+				// add the latency result to the results channel, measured from the intended send time and including
+				// the failed tries and their backoff, or the error if the request failed even after retrying
+				var result latency
+				start := time.Now()
+				attempt := start
+				failure, retried := tryRequest(func() (err error) {
+					attempt = time.Now()
+					result, err = run(o, payloadSize)
+					return err
 				})
+				result.Failure, result.Retries = failure, retried
+				result.FirstByte += queued + attempt.Sub(start)
+				result.LastByte += queued + attempt.Sub(start)
+				results <- result
+			}
+		}(w, testTasks, results)
+	}
 
-				resp, err := req.Send()
+	// close the results channel once all the workers are done
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
 
-				// if a request fails, exit
-				if err != nil {
-					panic("Failed to get object: " + err.Error())
-				}
+	// start the timer for this benchmark, and count the allocations of the client
+	allocs := startAllocStats()
+	resources := startTelemetry()
+	benchmarkTimer := time.Now()
 
-				// measure the first byte latency
-				firstByte := time.Now().Sub(latencyTimer)
+	// submit the test tasks until the sample count, duration or byte count of this test is reached
+	go func() {
+		interval := config.requestInterval(payloadSize)
+		for j := 0; !config.testDone(j, samples, payloadSize, benchmarkTimer); j++ {
+			// without a fixed rate, the next task is sent as soon as a thread is free
+			if interval == 0 {
+				testTasks <- time.Time{}
+				continue
+			}
 
-				// create a buffer to copy the S3 object body to
-				var buf = make([]byte, payloadSize)
+			// with a fixed rate, the task is sent at its intended time regardless of how many tasks are still
+			// running, and if the queue is full the intended time is kept so that the wait counts as latency
+			intended := benchmarkTimer.Add(time.Duration(j) * interval)
+			time.Sleep(intended.Sub(time.Now()))
+			testTasks <- intended
+		}
 
-				// read the s3 object body into the buffer
-				size := 0
-				for {
-					n, err := resp.Body.Read(buf)
+		// close the channel
+		close(testTasks)
+	}()
 
-					size += n
+	// construct a new benchmark record
+	benchmarkRecord := benchmark{
+		threads: threadCount,
+	}
+	var firstBytes, lastBytes histogram
 
-					if err == io.EOF {
-						break
-					}
+	// the latencies of every operation, only used by the mixed benchmark
+	operationRecords := make(map[string]*operationRecord)
 
-					// if the streaming fails, exit
-					if err != nil {
-						panic("Error reading object body: " + err.Error())
-					}
-				}
+	// the latencies of the phases of the HTTP requests, only used with the trace argument
+	phases := &phasesRecord{threads: threadCount}
 
-				_ = resp.Body.Close()
+	// the failed requests, which don't count as samples
+	var failures errorCounts
 
-				// measure the last byte latency
-				lastByte := time.Now().Sub(latencyTimer)
+	// wait for all the results to come and record the individual datapoints
+	for timing := range results {
+		failures.record(timing)
 
-				// add the latency result to the results channel
-				results <- latency{FirstByte: firstByte, LastByte: lastByte}
+		operation := timing.Operation
+		if operation == "" {
+			operation = mode
+		}
+		if timing.Failure != nil {
+			if config.record {
+				observeError(operation, payloadSize, threadCount)
 			}
-		}(w, testTasks, results)
-	}
+			continue
+		}
 
-	// start the timer for this benchmark
-	benchmarkTimer := time.Now()
+		benchmarkRecord.samples++
+		firstBytes.record(timing.FirstByte)
+		lastBytes.record(timing.LastByte)
+
+		if config.record {
+			observeRequest(operation, payloadSize, threadCount, timing)
+		}
+
+		if timing.Operation != "" {
+			recordOperation(operationRecords, timing)
+		}
+
+		if timing.Phases != nil {
+			phases.record(timing.Phases)
+		}
 
-	// submit all the test tasks
-	for j := 1; j <= samples; j++ {
-		testTasks <- j
+		// in mixed mode, only some of the operations transfer the payload
+		if timing.Operation == "" || transfersPayload(timing.Operation) {
+			transferred := payloadSize
+			if timing.Bytes > 0 {
+				transferred = timing.Bytes
+			}
+			benchmarkRecord.objectSize += transferred
+		}
 	}
 
-	// close the channel
-	close(testTasks)
+	// stop the timer for this benchmark, without the average time that the threads spent preparing the requests
+	totalTime := time.Now().Sub(benchmarkTimer) - preparationTime(prepared)
+	allocs.stop()
+	resources.stop()
 
-	// construct a new benchmark record
-	benchmarkRecord := benchmark{
-		firstByte: make(map[stat]float64),
-		lastByte:  make(map[stat]float64),
-	}
-	sumFirstByte := int64(0)
-	sumLastByte := int64(0)
-	benchmarkRecord.threads = threadCount
-
-	// wait for all the results to come and collect the individual datapoints
-	for s := 1; s <= samples; s++ {
-		timing := <-results
-		benchmarkRecord.dataPoints = append(benchmarkRecord.dataPoints, timing)
-		sumFirstByte += timing.FirstByte.Nanoseconds()
-		sumLastByte += timing.LastByte.Nanoseconds()
-		benchmarkRecord.objectSize += payloadSize
-	}
-
-	// stop the timer for this benchmark
-	totalTime := time.Now().Sub(benchmarkTimer)
-
-	// calculate the summary statistics for the first byte latencies
-	sort.Sort(ByFirstByte(benchmarkRecord.dataPoints))
-	benchmarkRecord.firstByte[avg] = (float64(sumFirstByte) / float64(samples)) / 1000000
-	benchmarkRecord.firstByte[min] = float64(benchmarkRecord.dataPoints[0].FirstByte.Nanoseconds()) / 1000000
-	benchmarkRecord.firstByte[max] = float64(benchmarkRecord.dataPoints[len(benchmarkRecord.dataPoints)-1].FirstByte.Nanoseconds()) / 1000000
-	benchmarkRecord.firstByte[p25] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.25))-1].FirstByte.Nanoseconds()) / 1000000
-	benchmarkRecord.firstByte[p50] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.5))-1].FirstByte.Nanoseconds()) / 1000000
-	benchmarkRecord.firstByte[p75] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.75))-1].FirstByte.Nanoseconds()) / 1000000
-	benchmarkRecord.firstByte[p90] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.90))-1].FirstByte.Nanoseconds()) / 1000000
-	benchmarkRecord.firstByte[p99] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.99))-1].FirstByte.Nanoseconds()) / 1000000
-
-	// calculate the summary statistics for the last byte latencies
-	sort.Sort(ByLastByte(benchmarkRecord.dataPoints))
-	benchmarkRecord.lastByte[avg] = (float64(sumLastByte) / float64(samples)) / 1000000
-	benchmarkRecord.lastByte[min] = float64(benchmarkRecord.dataPoints[0].LastByte.Nanoseconds()) / 1000000
-	benchmarkRecord.lastByte[max] = float64(benchmarkRecord.dataPoints[len(benchmarkRecord.dataPoints)-1].LastByte.Nanoseconds()) / 1000000
-	benchmarkRecord.lastByte[p25] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.25))-1].LastByte.Nanoseconds()) / 1000000
-	benchmarkRecord.lastByte[p50] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.5))-1].LastByte.Nanoseconds()) / 1000000
-	benchmarkRecord.lastByte[p75] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.75))-1].LastByte.Nanoseconds()) / 1000000
-	benchmarkRecord.lastByte[p90] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.90))-1].LastByte.Nanoseconds()) / 1000000
-	benchmarkRecord.lastByte[p99] = float64(benchmarkRecord.dataPoints[int(float64(samples)*float64(0.99))-1].LastByte.Nanoseconds()) / 1000000
-
-	// calculate the throughput rate
+	// there are no latencies to summarize if every request failed, which only stops the benchmark with fail-fast
+	failures.checkSamples(benchmarkRecord.samples)
+
+	// calculate the summary statistics for the first byte and last byte latencies
+	benchmarkRecord.firstByte = firstBytes.summary()
+	benchmarkRecord.lastByte = lastBytes.summary()
+
+	// calculate the throughput rate, either in MB/s or in requests per second
 	rate := (float64(benchmarkRecord.objectSize)) / (totalTime.Seconds()) / 1024 / 1024
+	rateColumn := fmt.Sprintf("%9.1f MB/s", rate)
+	if benchmarkModes[mode].countsRequests {
+		rate = float64(benchmarkRecord.samples) / totalTime.Seconds()
+		rateColumn = fmt.Sprintf("%9.1f op/s", rate)
+	}
+
+	// the requests of the delete benchmark delete a whole batch of objects each, so it counts the objects
+	var objectRate float64
+	if mode == "delete" && deleteBatch > 1 {
+		objectRate = float64(benchmarkRecord.samples*deleteBatch) / totalTime.Seconds()
+		rateColumn = fmt.Sprintf("%8.1f obj/s", objectRate)
+	}
 
 	// determine what to put in the first column of the results
 	c := benchmarkRecord.threads
@@ -502,37 +926,121 @@ func execTest(threadCount int, payloadSize uint64, runNumber int, csvRecords [][
 	}
 
 	// print the results to stdout
-	fmt.Printf("| %7d | \033[1;31m%9.1f MB/s\033[0m |%5.0f %5.0f %5.0f %5.0f %5.0f %5.0f %5.0f %5.0f |%5.0f %5.0f %5.0f %5.0f %5.0f %5.0f %5.0f %5.0f |\n",
-		c, rate,
-		benchmarkRecord.firstByte[avg], benchmarkRecord.firstByte[min], benchmarkRecord.firstByte[p25], benchmarkRecord.firstByte[p50], benchmarkRecord.firstByte[p75], benchmarkRecord.firstByte[p90], benchmarkRecord.firstByte[p99], benchmarkRecord.firstByte[max],
-		benchmarkRecord.lastByte[avg], benchmarkRecord.lastByte[min], benchmarkRecord.lastByte[p25], benchmarkRecord.lastByte[p50], benchmarkRecord.lastByte[p75], benchmarkRecord.lastByte[p90], benchmarkRecord.lastByte[p99], benchmarkRecord.lastByte[max])
-
-	// add the results to the csv array
-	csvRecords = append(csvRecords, []string{
-		fmt.Sprintf("%s", hostname),
-		fmt.Sprintf("%s", instanceType),
-		fmt.Sprintf("%d", payloadSize),
-		fmt.Sprintf("%d", benchmarkRecord.threads),
-		fmt.Sprintf("%.3f", rate),
-		fmt.Sprintf("%.1f", benchmarkRecord.firstByte[avg]),
-		fmt.Sprintf("%.1f", benchmarkRecord.firstByte[min]),
-		fmt.Sprintf("%.1f", benchmarkRecord.firstByte[p25]),
-		fmt.Sprintf("%.1f", benchmarkRecord.firstByte[p50]),
-		fmt.Sprintf("%.1f", benchmarkRecord.firstByte[p75]),
-		fmt.Sprintf("%.1f", benchmarkRecord.firstByte[p90]),
-		fmt.Sprintf("%.1f", benchmarkRecord.firstByte[p99]),
-		fmt.Sprintf("%.1f", benchmarkRecord.firstByte[max]),
-		fmt.Sprintf("%.2f", benchmarkRecord.lastByte[avg]),
-		fmt.Sprintf("%.2f", benchmarkRecord.lastByte[min]),
-		fmt.Sprintf("%.1f", benchmarkRecord.lastByte[p25]),
-		fmt.Sprintf("%.1f", benchmarkRecord.lastByte[p50]),
-		fmt.Sprintf("%.1f", benchmarkRecord.lastByte[p75]),
-		fmt.Sprintf("%.1f", benchmarkRecord.lastByte[p90]),
-		fmt.Sprintf("%.1f", benchmarkRecord.lastByte[p99]),
-		fmt.Sprintf("%.1f", benchmarkRecord.lastByte[max]),
-	})
-
-	return csvRecords
+	fmt.Fprintf(console, "| %7d | \033[1;31m%s\033[0m | %6.1f%% |%s|%s|%s|%s|\n",
+		c, rateColumn, failures.percent(benchmarkRecord.samples), allocs.columns(benchmarkRecord.samples+int(failures.total())),
+		resources.columns(), statsColumn(benchmarkRecord.firstByte), statsColumn(benchmarkRecord.lastByte))
+
+	// in mixed mode, also print the results of every operation on its own
+	if mode == "mixed" {
+		printMixedResults(operationRecords, totalTime)
+	}
+	failures.printAllFailed(benchmarkRecord.samples)
+
+	// the requests that couldn't be prepared aren't errors of the benchmark, but they are reported like the setup
+	printSetupFailures("prepare")
+
+	// keep the phases of the HTTP requests to print them after the results of this object size, which never comes
+	// in throttling mode
+	if phases.requests > 0 && !throttlingMode && config.record {
+		phasesRecords = append(phasesRecords, phases)
+	}
+
+	// the results of this test
+	r := result{
+		ObjectSize:  payloadSize,
+		Threads:     benchmarkRecord.threads,
+		Samples:     benchmarkRecord.samples,
+		Bytes:       benchmarkRecord.objectSize,
+		Seconds:     totalTime.Seconds(),
+		Throughput:  float64(benchmarkRecord.objectSize) / totalTime.Seconds() / 1024 / 1024,
+		RequestRate: float64(benchmarkRecord.samples) / totalTime.Seconds(),
+		ObjectRate:  objectRate,
+		FirstByte:   benchmarkRecord.firstByte.stats(),
+		LastByte:    benchmarkRecord.lastByte.stats(),
+		Operations:  operationResults(operationRecords, totalTime),
+	}
+	if throttlingMode {
+		r.Run = runNumber
+	}
+	if phases.requests > 0 {
+		r.Phases, r.ReusedConnections = phases.results()
+	}
+	r.setErrors(failures)
+	r.setAllocations(allocs, benchmarkRecord.samples+int(failures.total()))
+	r.setTelemetry(resources)
+
+	// add the results to the structured results and the csv records
+	if !config.record {
+		return csvRecords, r
+	}
+	return recordResult(r, csvRecords), r
+}
+
+// downloads the object of the given thread index and size, and measures the first byte and last byte latencies
+func getObject(threadIndex int, payloadSize uint64) (latency, error) {
+	// generate an S3 key from the sha hash of the hostname, thread index, and object size
+	key := generateS3Key(hostname, threadIndex, payloadSize)
+
+	// start the timer to measure the first byte and last byte latencies
+	latencyTimer := time.Now()
+
+	// do the GetObject request
+	ctx, trace := traceRequest()
+	body, err := store.GetObject(ctx, bucketName, key, "")
+
+	// if a request fails, fail the sample
+	if err != nil {
+		return latency{}, failRequest("Failed to get object", err)
+	}
+
+	// measure the first byte latency
+	firstByte := time.Now().Sub(latencyTimer)
+
+	// read the whole s3 object body
+	if err := readBody(body, payloadSize); err != nil {
+		return latency{}, err
+	}
+
+	// measure the last byte latency
+	lastByte := time.Now().Sub(latencyTimer)
+
+	return trace.finish(latency{FirstByte: firstByte, LastByte: lastByte}, latencyTimer), nil
+}
+
+// reads an s3 object body of the given size to the end, checks that it has the zero bytes of the uploaded object, and
+// closes it
+func readBody(body io.ReadCloser, payloadSize uint64) error {
+	defer body.Close()
+
+	// read the s3 object body into a reused buffer of a fixed size, and discard it
+	buf := readBuffers.Get().(*[]byte)
+	defer readBuffers.Put(buf)
+
+	size := 0
+	for {
+		n, err := body.Read(*buf)
+
+		// a body with other bytes than the zero bytes of the object was corrupted on the way
+		if !bytes.Equal((*buf)[:n], readZeroes[:n]) {
+			return failRequest("Error reading object body", fmt.Errorf("%w: a byte that isn't zero after %d bytes", errChecksum, size))
+		}
+		size += n
+
+		if err == io.EOF {
+			break
+		}
+
+		// if the streaming fails, fail the sample
+		if err != nil {
+			return failRequest("Error reading object body", err)
+		}
+	}
+
+	// a body that was cut short or is larger than the object doesn't match it either
+	if uint64(size) != payloadSize {
+		return failRequest("Error reading object body", fmt.Errorf("%w: %d bytes instead of %d", errChecksum, size, payloadSize))
+	}
+	return nil
 }
 
 // prints the table header for the test results
@@ -544,66 +1052,94 @@ func printHeader(objectSize uint64) {
 		instanceTypeString = " (" + instanceType + ")"
 	}
 
+	// rate string used to render the fixed rate at which requests are sent, if any
+	rateString := ""
+
+	if interval := benchmarkConfig().requestInterval(objectSize); interval > 0 {
+		rateString = fmt.Sprintf(" at \033[1;33m%.1f requests/s\033[0m", float64(time.Second)/float64(interval))
+	}
+
+	// the titles depend on the S3 operation being measured
+	m := benchmarkModes[mode]
+
+	// what the payload size refers to
+	payloadTitle := "objects"
+	if m.payloadTitle != "" {
+		payloadTitle = m.payloadTitle
+	}
+
 	// print the table header
-	fmt.Printf("Download performance with \033[1;33m%-s\033[0m objects%s\n", byteFormat(float64(objectSize)), instanceTypeString)
-	fmt.Println("                           +-------------------------------------------------------------------------------------------------+")
-	fmt.Println("                           |            Time to First Byte (ms)             |            Time to Last Byte (ms)              |")
-	fmt.Println("+---------+----------------+------------------------------------------------+------------------------------------------------+")
+	if m.payloadless {
+		fmt.Fprintf(console, "%s performance%s%s\n", m.title, rateString, instanceTypeString)
+	} else {
+		fmt.Fprintf(console, "%s performance with \033[1;33m%-s\033[0m %s%s%s\n", m.title, byteFormat(float64(objectSize)), payloadTitle, rateString, instanceTypeString)
+	}
 	if !throttlingMode {
-		fmt.Println("| Threads |     Throughput |  avg   min   p25   p50   p75   p90   p99   max |  avg   min   p25   p50   p75   p90   p99   max |")
+		threadsTable.printHeader(m.firstByteTitle, m.lastByteTitle)
 	} else {
-		fmt.Println("|       # |     Throughput |  avg   min   p25   p50   p75   p90   p99   max |  avg   min   p25   p50   p75   p90   p99   max |")
+		throttlingTable.printHeader(m.firstByteTitle, m.lastByteTitle)
+	}
+}
+
+// pads the text with spaces on both sides to center it in a column of the given width
+func centerText(text string, width int) string {
+	if len(text) >= width {
+		return text
 	}
-	fmt.Println("+---------+----------------+------------------------------------------------+------------------------------------------------+")
+	left := (width - len(text)) / 2
+	return strings.Repeat(" ", left) + text + strings.Repeat(" ", width-len(text)-left)
 }
 
 // generates an S3 key from the sha hash of the hostname, thread index, and object size
 func generateS3Key(host string, threadIndex int, payloadSize uint64) string {
 	keyHash := sha1.Sum([]byte(fmt.Sprintf("%s-%03d-%012d", host, threadIndex, payloadSize)))
-	key := fmt.Sprintf("%x", keyHash)
+	key := fmt.Sprintf("%s%x", keyPrefix, keyHash)
 	return key
 }
 
 // cleans up the objects uploaded to S3 for this test (but doesn't remove the bucket)
 func cleanup() {
-	fmt.Print("\n--- \033[1;32mCLEANUP\033[0m ------------------------------------------------------------------------------------------------------------------\n\n")
-
-	fmt.Printf("Deleting any objects uploaded from %s\n", hostname)
+	fmt.Fprint(console, "\n--- \033[1;32mCLEANUP\033[0m ------------------------------------------------------------------------------------------------------------------\n\n")
 
-	// create a progress bar
-	bar := progressbar.NewOptions(maxPayload*maxThreads-1, progressbar.OptionSetRenderBlankState(true))
+	fmt.Fprintf(console, "Deleting any objects uploaded from %s\n", hostname)
 
-	// an object size iterator that starts from 1 KB and doubles the size on every iteration
-	generatePayload := payloadSizeGenerator()
+	// the object sizes of this test, and the power of two sizes of any previous test execution
+	sizes := append([]uint64{}, payloadSizes...)
+	for _, size := range powerOfTwoSizes(1, maxPayload) {
+		if !containsValue(sizes, size) {
+			sizes = append(sizes, size)
+		}
+	}
 
-	// loop over every payload size
-	for p := 1; p <= maxPayload; p++ {
-		// get an object size from the iterator
-		payloadSize := generatePayload()
+	// the thread counts of this test, or of any previous test execution with the default thread counts
+	threads := maxThreads
+	if threadsMax > threads {
+		threads = threadsMax
+	}
 
-		// loop over each possible thread to clean up objects from any previous test execution
-		for t := 1; t <= maxThreads; t++ {
-			// increment the progress bar
-			_ = bar.Add(1)
+	// the keys of every payload size and thread of any previous test execution, with the destination objects of the
+	// copy benchmark, the objects written by the mixed benchmark, and those of the delete benchmark that weren't
+	// deleted, most of which don't exist, so they're deleted in batches
+	var keys []string
+	for _, payloadSize := range sizes {
+		for t := 1; t <= threads; t++ {
+			keys = append(keys, generateS3Key(hostname, t, payloadSize), generateS3Key(hostname+"-copy", t, payloadSize),
+				generateS3Key(hostname+"-mixed", t, payloadSize))
+			keys = append(keys, deleteKeys(t, payloadSize)...)
+		}
+	}
 
-			// generate an S3 key from the sha hash of the hostname, thread index, and object size
-			key := generateS3Key(hostname, t, payloadSize)
+	// and the large object read by the random range benchmark
+	keys = append(keys, generateS3Key(hostname, 1, rangeObjectSize))
+	deleteAllKeys(keys)
 
-			// make a DeleteObject request
-			headReq := s3Client.DeleteObjectRequest(&s3.DeleteObjectInput{
-				Bucket: aws.String(bucketName),
-				Key:    aws.String(key),
-			})
+	// delete the objects listed by the list benchmark
+	cleanupListObjects()
 
-			_, err := headReq.Send()
+	fmt.Fprint(console, "\n\n")
 
-			// if the object doesn't exist, ignore the error
-			if err != nil && !strings.HasPrefix(err.Error(), "NotFound: Not Found") {
-				panic("Failed to delete object: " + err.Error())
-			}
-		}
-	}
-	fmt.Print("\n\n")
+	// the objects that couldn't be deleted are left behind, but they don't affect the next test
+	printSetupFailures("delete")
 }
 
 // gets the hostname or the EC2 instance ID
@@ -620,12 +1156,23 @@ func getHostname() string {
 	return hostname
 }
 
-// formats bytes to KB or MB
+// formats bytes to KB, MB or GB
 func byteFormat(bytes float64) string {
+	if bytes >= 1024*1024*1024 {
+		return sizeFormat(bytes/1024/1024/1024, "GB")
+	}
 	if bytes >= 1024*1024 {
-		return fmt.Sprintf("%.f MB", bytes/1024/1024)
+		return sizeFormat(bytes/1024/1024, "MB")
+	}
+	return sizeFormat(bytes/1024, "KB")
+}
+
+// formats a size in the given unit, with a decimal only for sizes that aren't a whole number of the unit
+func sizeFormat(size float64, unit string) string {
+	if size == math.Trunc(size) {
+		return fmt.Sprintf("%.f %s", size, unit)
 	}
-	return fmt.Sprintf("%.f KB", bytes/1024)
+	return fmt.Sprintf("%.1f %s", size, unit)
 }
 
 // gets the EC2 region from the instance metadata
@@ -684,15 +1231,61 @@ func getInstanceId() string {
 	return string(content)
 }
 
-// returns an object size iterator, starting from 1 KB and double in size by each iteration
-func payloadSizeGenerator() func() uint64 {
-	nextPayloadSize := uint64(1024)
+// the settings of a test, which come from the arguments for the tests of the benchmark, and differ for the calibration
+type testConfig struct {
+	// the fixed rate at which the requests are sent, in requests or bytes per second, or 0 to send them as soon as a
+	// thread is free
+	requestRate      float64
+	requestRateBytes float64
+
+	// the duration or the number of bytes after which the test ends, instead of the sample count, if not 0
+	duration    time.Duration
+	targetBytes uint64
+
+	// whether the results of the test are recorded in the structured results and the metrics
+	record bool
+}
+
+// returns the settings of the tests of the benchmark, as given by the arguments
+func benchmarkConfig() testConfig {
+	return testConfig{
+		requestRate:      requestRate,
+		requestRateBytes: requestRateBytes,
+		duration:         testDuration,
+		targetBytes:      targetBytes,
+		record:           true,
+	}
+}
+
+// whether a test is done after the given number of samples, which is when the duration or byte count arguments are
+// reached if set, or else the given sample count
+func (c testConfig) testDone(sampleCount int, samples int, bytesPerSample uint64, start time.Time) bool {
+	// every test needs at least one sample to summarize
+	if sampleCount == 0 {
+		return false
+	}
+
+	if c.duration > 0 || c.targetBytes > 0 {
+		return (c.duration > 0 && time.Now().Sub(start) >= c.duration) ||
+			(c.targetBytes > 0 && uint64(sampleCount)*bytesPerSample >= c.targetBytes)
+	}
+
+	return sampleCount >= samples
+}
+
+// returns the time between two requests for objects of the given size when sending requests at a fixed rate, or 0
+// if the requests are sent as soon as a thread is free
+func (c testConfig) requestInterval(payloadSize uint64) time.Duration {
+	rate := c.requestRate
+	if c.requestRateBytes > 0 && payloadSize > 0 {
+		rate = c.requestRateBytes / float64(payloadSize)
+	}
 
-	return func() uint64 {
-		thisPayloadSize := nextPayloadSize
-		nextPayloadSize *= 2
-		return thisPayloadSize
+	if rate <= 0 {
+		return 0
 	}
+
+	return time.Duration(float64(time.Second) / rate)
 }
 
 // adjust the sample count for small instances and for low thread counts (so that the test doesn't take forever)
@@ -722,17 +1315,3 @@ func minimumOf(x, y int) int {
 	}
 	return y
 }
-
-// comparator to sort by first byte latency
-type ByFirstByte []latency
-
-func (a ByFirstByte) Len() int           { return len(a) }
-func (a ByFirstByte) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a ByFirstByte) Less(i, j int) bool { return a[i].FirstByte < a[j].FirstByte }
-
-// comparator to sort by last byte latency
-type ByLastByte []latency
-
-func (a ByLastByte) Len() int           { return len(a) }
-func (a ByLastByte) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a ByLastByte) Less(i, j int) bool { return a[i].LastByte < a[j].LastByte }
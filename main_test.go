@@ -0,0 +1,724 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// the globals that the arguments would set and that the tests change, which all the tests of the package share
+type testGlobals struct {
+	store             objectStore
+	console           io.Writer
+	outputFormat      string
+	bucketName        string
+	region            string
+	hostname          string
+	createBucket      bool
+	mode              string
+	samples           int
+	percentiles       []float64
+	payloadSizes      []uint64
+	threadsMin        int
+	threadsMax        int
+	threadCounts      []int
+	retries           int
+	retryBackoff      time.Duration
+	failFast          bool
+	mixWeights        []int
+	deleteBatch       int
+	rangeObjectSize   uint64
+	saturationGain    float64
+	saturationLatency float64
+	metricsAddress    string
+	metrics           map[metricsLabels]*metricsSeries
+}
+
+// returns the current values of the globals that the tests change
+func saveGlobals() testGlobals {
+	return testGlobals{
+		store:             store,
+		console:           console,
+		outputFormat:      outputFormat,
+		bucketName:        bucketName,
+		region:            region,
+		hostname:          hostname,
+		createBucket:      createBucket,
+		mode:              mode,
+		samples:           samples,
+		percentiles:       percentiles,
+		payloadSizes:      payloadSizes,
+		threadsMin:        threadsMin,
+		threadsMax:        threadsMax,
+		threadCounts:      threadCounts,
+		retries:           retries,
+		retryBackoff:      retryBackoff,
+		failFast:          failFast,
+		mixWeights:        mixWeights,
+		deleteBatch:       deleteBatch,
+		rangeObjectSize:   rangeObjectSize,
+		saturationGain:    saturationGain,
+		saturationLatency: saturationLatency,
+		metricsAddress:    metricsAddress,
+		metrics:           metrics,
+	}
+}
+
+// sets the globals back to the saved values, so that a test doesn't leak its arguments into the next one
+func (g testGlobals) restore() {
+	store = g.store
+	console = g.console
+	outputFormat = g.outputFormat
+	bucketName = g.bucketName
+	region = g.region
+	hostname = g.hostname
+	createBucket = g.createBucket
+	mode = g.mode
+	samples = g.samples
+	percentiles = g.percentiles
+	payloadSizes = g.payloadSizes
+	threadsMin = g.threadsMin
+	threadsMax = g.threadsMax
+	threadCounts = g.threadCounts
+	retries = g.retries
+	retryBackoff = g.retryBackoff
+	failFast = g.failFast
+	mixWeights = g.mixWeights
+	deleteBatch = g.deleteBatch
+	rangeObjectSize = g.rangeObjectSize
+	saturationGain = g.saturationGain
+	saturationLatency = g.saturationLatency
+	metricsAddress = g.metricsAddress
+	metrics = g.metrics
+}
+
+// runs the benchmarks against a new in-memory store, with the globals that the arguments would set, and returns a
+// function that restores the globals, which the test defers
+func useMemoryStore(t *testing.T, benchmarkMode string) (*memoryStore, func()) {
+	t.Helper()
+
+	restore := saveGlobals().restore
+	s := newMemoryStore()
+	store = s
+
+	console = ioutil.Discard
+	outputFormat = "table"
+	bucketName = "test-bucket"
+	region = "us-east-1"
+	hostname = "test-host"
+	createBucket = true
+	mode = benchmarkMode
+	samples = 50
+	percentiles = []float64{50, 99}
+	payloadSizes = []uint64{1024, 4096}
+	threadsMin, threadsMax = 1, 4
+	threadCounts = []int{1, 2, 4}
+	retries, retryBackoff = 0, time.Millisecond
+	failFast = false
+
+	return s, restore
+}
+
+// returns the number of objects in the test bucket
+func objectCount(t *testing.T, s *memoryStore) int {
+	t.Helper()
+
+	keys, _, err := s.ListObjects(context.Background(), bucketName, "", 100000, nil)
+	if err != nil {
+		t.Fatalf("Failed to list the objects: %v", err)
+	}
+	return len(keys)
+}
+
+func TestSetupUploadsObjectPerThreadAndSize(t *testing.T) {
+	s, restore := useMemoryStore(t, "get")
+	defer restore()
+
+	setup()
+
+	if n := objectCount(t, s); n != len(payloadSizes)*threadsMax {
+		t.Fatalf("Expected %d objects, got %d", len(payloadSizes)*threadsMax, n)
+	}
+	for _, size := range payloadSizes {
+		for thread := 1; thread <= threadsMax; thread++ {
+			content, err := s.object(bucketName, generateS3Key(hostname, thread, size))
+			if err != nil {
+				t.Fatalf("Missing the object of thread %d and size %d: %v", thread, size, err)
+			}
+			if uint64(len(content)) != size {
+				t.Fatalf("Expected an object of %d bytes, got %d", size, len(content))
+			}
+		}
+	}
+
+	// a second setup finds the objects, and the bucket already exists
+	setup()
+	if n := objectCount(t, s); n != len(payloadSizes)*threadsMax {
+		t.Fatalf("Expected %d objects after the second setup, got %d", len(payloadSizes)*threadsMax, n)
+	}
+}
+
+func TestSetupUploadsNothingForPuts(t *testing.T) {
+	s, restore := useMemoryStore(t, "put")
+	defer restore()
+
+	setup()
+
+	if n := objectCount(t, s); n != 0 {
+		t.Fatalf("Expected no objects, got %d", n)
+	}
+}
+
+func TestExecTestGet(t *testing.T) {
+	s, restore := useMemoryStore(t, "get")
+	defer restore()
+	s.latency = 5 * time.Millisecond
+	setup()
+
+	records, r := execTest(benchmarkConfig(), 4, 4096, 1, nil)
+
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 csv record, got %d", len(records))
+	}
+	if r.Samples != 50 || r.Threads != 4 || r.ObjectSize != 4096 {
+		t.Fatalf("Unexpected results: %+v", r)
+	}
+	if r.Bytes != 50*4096 {
+		t.Fatalf("Expected %d bytes, got %d", 50*4096, r.Bytes)
+	}
+	if r.Errors != 0 || r.Retries != 0 {
+		t.Fatalf("Expected no errors or retries, got %d and %d", r.Errors, r.Retries)
+	}
+	if r.FirstByte.Min < 5 || r.LastByte.Min < r.FirstByte.Min {
+		t.Fatalf("Expected latencies of at least the store latency, got %+v and %+v", r.FirstByte, r.LastByte)
+	}
+	if r.Throughput <= 0 || r.RequestRate <= 0 {
+		t.Fatalf("Expected a throughput and request rate, got %f and %f", r.Throughput, r.RequestRate)
+	}
+}
+
+func TestExecTestBandwidth(t *testing.T) {
+	s, restore := useMemoryStore(t, "get")
+	defer restore()
+	s.bandwidth = 1024 * 1024
+	setup()
+
+	// 4 threads that read 4 KB objects at 1 MB/s each can't read more than 4 MB/s, and the timers of a busy machine
+	// only ever make the reads slower, so only the upper bound of the throughput and the lower bound of the latency
+	// are checked, with some room for the rounding of the timers
+	_, r := execTest(benchmarkConfig(), 4, 4096, 1, nil)
+
+	if r.Samples != 50 || r.Bytes != 50*4096 {
+		t.Fatalf("Expected 50 samples of 4 KB, got %d samples and %d bytes", r.Samples, r.Bytes)
+	}
+	if r.Throughput > 4.4 {
+		t.Fatalf("Expected a throughput of at most 4 MB/s, got %f", r.Throughput)
+	}
+	if r.LastByte.Min < 3 {
+		t.Fatalf("Expected reading 4 KB at 1 MB/s to take about 4 ms, got %f", r.LastByte.Min)
+	}
+}
+
+func TestExecTestPut(t *testing.T) {
+	s, restore := useMemoryStore(t, "put")
+	defer restore()
+	setup()
+
+	_, r := execTest(benchmarkConfig(), 2, 1024, 1, nil)
+
+	if r.Samples != 50 || r.Errors != 0 {
+		t.Fatalf("Unexpected results: %+v", r)
+	}
+
+	// every thread overwrites its own object
+	if n := objectCount(t, s); n != 2 {
+		t.Fatalf("Expected 2 objects, got %d", n)
+	}
+}
+
+func TestExecTestDeleteBatch(t *testing.T) {
+	s, restore := useMemoryStore(t, "delete")
+	defer restore()
+	setup()
+	s.latency = 5 * time.Millisecond
+	deleteBatch = 10
+	samples = 10
+
+	_, r := execTest(benchmarkConfig(), 1, 1024, 1, nil)
+
+	if r.Samples != 10 || r.Errors != 0 {
+		t.Fatalf("Unexpected results: %+v", r)
+	}
+
+	// every request takes at least 5ms, so the rate can't be above 200 requests per second, and with the 10 uploads
+	// before every delete it would be below 20 if the uploads were measured, which leaves a wide margin for a busy
+	// machine in between
+	if r.RequestRate < 40 || r.RequestRate > 200 {
+		t.Fatalf("Expected about 200 requests per second without the uploads, got %f", r.RequestRate)
+	}
+	if math.Abs(r.ObjectRate-r.RequestRate*10) > 0.001 {
+		t.Fatalf("Expected 10 objects per request, got %f objects and %f requests per second", r.ObjectRate, r.RequestRate)
+	}
+	if n := objectCount(t, s); n != 0 {
+		t.Fatalf("Expected all the objects to be deleted, got %d", n)
+	}
+}
+
+func TestExecTestRandomRangeCountsRequestedBytes(t *testing.T) {
+	_, restore := useMemoryStore(t, "random-range")
+	defer restore()
+	rangeObjectSize = 2048
+	setup()
+
+	// the ranges of 4 KB are capped to the object of 2 KB
+	_, r := execTest(benchmarkConfig(), 2, 4096, 1, nil)
+
+	if r.Samples != 50 || r.Errors != 0 {
+		t.Fatalf("Unexpected results: %+v", r)
+	}
+	if r.Bytes != 50*2048 {
+		t.Fatalf("Expected %d bytes, got %d", 50*2048, r.Bytes)
+	}
+}
+
+func TestParseFlagsRejectsEmptyRanges(t *testing.T) {
+	defer parseFlags(nil)
+
+	for _, args := range [][]string{
+		{"-mode=random-range", "-range-object-size=0"},
+		{"-mode=random-range", "-sizes=0,1KiB"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected %v to fail", args)
+				}
+			}()
+			parseFlags(args)
+		}()
+	}
+}
+
+func TestExecTestCountsErrors(t *testing.T) {
+	s, restore := useMemoryStore(t, "get")
+	defer restore()
+	setup()
+	s.errorRate = 0.5
+
+	_, r := execTest(benchmarkConfig(), 4, 1024, 1, nil)
+
+	if r.Errors == 0 || uint64(r.Samples)+r.Errors != 50 {
+		t.Fatalf("Expected some of the 50 requests to fail, got %d samples and %d errors", r.Samples, r.Errors)
+	}
+	if r.ErrorClasses["throttle"] != r.Errors {
+		t.Fatalf("Expected only throttling errors, got %v", r.ErrorClasses)
+	}
+	if r.ErrorPercent <= 0 || r.ErrorPercent >= 100 {
+		t.Fatalf("Expected an error rate between 0 and 100%%, got %f", r.ErrorPercent)
+	}
+}
+
+func TestExecTestObservesErrorsByOperation(t *testing.T) {
+	s, restore := useMemoryStore(t, "mixed")
+	defer restore()
+	mixWeights = []int{1, 1, 0, 0}
+	metricsAddress = "localhost:0"
+	metrics = make(map[metricsLabels]*metricsSeries)
+	setup()
+	s.errorRate = 1
+
+	execTest(benchmarkConfig(), 2, 1024, 1, nil)
+
+	// the series of the mode only has the throughput of the test
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	failed := make(map[string]uint64)
+	for labels, series := range metrics {
+		failed[labels.operation] += series.errors
+	}
+	if failed["get"] == 0 || failed["put"] == 0 || failed["get"]+failed["put"] != 50 {
+		t.Fatalf("Expected the errors of the get and put operations, got %v", failed)
+	}
+}
+
+func TestExecTestObservesThroughputByOperation(t *testing.T) {
+	_, restore := useMemoryStore(t, "mixed")
+	defer restore()
+	mixWeights = []int{1, 1, 0, 0}
+	metricsAddress = "localhost:0"
+	metrics = make(map[metricsLabels]*metricsSeries)
+	setup()
+
+	execTest(benchmarkConfig(), 2, 1024, 1, nil)
+
+	// the gauges of the mode and of every operation of the mix are set, and those of the operations add up to the mode
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+	rates := make(map[string]float64)
+	for labels, series := range metrics {
+		if labels.threads == 2 {
+			rates[labels.operation] += series.requestRate
+		}
+	}
+	if rates["get"] == 0 || rates["put"] == 0 || math.Abs(rates["get"]+rates["put"]-rates["mixed"]) > rates["mixed"]/1000 {
+		t.Fatalf("Expected the request rates of the get and put operations to add up to the mixed one, got %v", rates)
+	}
+	if metrics[metricsLabels{operation: "head", payloadSize: 1024, threads: 2}] != nil {
+		t.Fatal("Expected no series for an operation that isn't in the mix")
+	}
+	if metrics[metricsLabels{operation: "get", payloadSize: 1024, threads: 2}].throughput == 0 {
+		t.Fatal("Expected the throughput of the get operation")
+	}
+}
+
+func TestExecTestRetries(t *testing.T) {
+	s, restore := useMemoryStore(t, "get")
+	defer restore()
+	setup()
+	s.errorRate = 0.3
+	retries = 20
+
+	_, r := execTest(benchmarkConfig(), 4, 1024, 1, nil)
+
+	if r.Errors != 0 || r.Samples != 50 {
+		t.Fatalf("Expected the retries to hide all the errors, got %d samples and %d errors", r.Samples, r.Errors)
+	}
+	if r.Retries == 0 {
+		t.Fatal("Expected some retries")
+	}
+}
+
+func TestExecTestLatencyIncludesRetries(t *testing.T) {
+	_, restore := useMemoryStore(t, "retry")
+	defer restore()
+	retries = 1
+
+	// every other try fails after 20ms, so that every request succeeds on its retry
+	tries := 0
+	benchmarkModes["retry"] = benchmarkMode{run: func(threadIndex int, payloadSize uint64) (latency, error) {
+		tries++
+		if tries%2 == 1 {
+			time.Sleep(20 * time.Millisecond)
+			return latency{}, failRequest("Failed to get object", errors.New("SlowDown: Please reduce your request rate."))
+		}
+		return latency{FirstByte: time.Millisecond, LastByte: time.Millisecond}, nil
+	}}
+	defer delete(benchmarkModes, "retry")
+	samples = 5
+
+	_, r := execTest(benchmarkConfig(), 1, 1024, 1, nil)
+
+	if r.Samples != 5 || r.Retries != 5 {
+		t.Fatalf("Expected 5 samples with a retry each, got %d samples and %d retries", r.Samples, r.Retries)
+	}
+	if r.LastByte.Min < 20 {
+		t.Fatalf("Expected the latencies to include the failed tries, got a minimum of %f ms", r.LastByte.Min)
+	}
+}
+
+func TestExecTestReportsAllRequestsFailing(t *testing.T) {
+	_, restore := useMemoryStore(t, "get")
+	defer restore()
+
+	// without a setup, none of the objects exist
+	_, r := execTest(benchmarkConfig(), 1, 1024, 1, nil)
+
+	if r.Samples != 0 || r.Errors != 50 || r.ErrorPercent != 100 {
+		t.Fatalf("Expected 50 errors and no samples, got %d samples and %d errors", r.Samples, r.Errors)
+	}
+	if r.ErrorClasses["other"] != 50 {
+		t.Fatalf("Expected the missing objects to fail with other errors, got %v", r.ErrorClasses)
+	}
+	if r.LastByte.Count != 0 || r.LastByte.Max != 0 {
+		t.Fatalf("Expected no latencies, got %+v", r.LastByte)
+	}
+}
+
+func TestExecTestFailFast(t *testing.T) {
+	_, restore := useMemoryStore(t, "get")
+	defer restore()
+	failFast = true
+
+	// without a setup, none of the objects exist
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic")
+		}
+	}()
+	execTest(benchmarkConfig(), 1, 1024, 1, nil)
+}
+
+func TestMultipartUpload(t *testing.T) {
+	s, restore := useMemoryStore(t, "multipart")
+	defer restore()
+	samples = 3
+	setup()
+
+	_ = execMultipartTest(20*1024*1024, 8*1024*1024, 2, nil)
+
+	content, err := s.object(bucketName, generateS3Key(hostname, 1, 20*1024*1024))
+	if err != nil {
+		t.Fatalf("Missing the uploaded object: %v", err)
+	}
+	if len(content) != 20*1024*1024 {
+		t.Fatalf("Expected an object of 20 MB, got %d bytes", len(content))
+	}
+	if len(s.uploads) != 0 {
+		t.Fatalf("Expected no incomplete uploads, got %d", len(s.uploads))
+	}
+}
+
+func TestCleanupDeletesObjects(t *testing.T) {
+	s, restore := useMemoryStore(t, "get")
+	defer restore()
+	setup()
+
+	// the objects of the other benchmarks are deleted too
+	mode = "copy"
+	_, _ = execTest(benchmarkConfig(), 2, 1024, 1, nil)
+
+	if n := objectCount(t, s); n == 0 {
+		t.Fatal("Expected objects before the cleanup")
+	}
+
+	// and so are the objects of a batch that wasn't deleted
+	deleteBatch = 10
+	if err := uploadDeleteBatch(1, 1024); err != nil {
+		t.Fatalf("Failed to upload the delete batch: %v", err)
+	}
+
+	cleanup()
+
+	if n := objectCount(t, s); n != 0 {
+		t.Fatalf("Expected no objects after the cleanup, got %d", n)
+	}
+}
+
+func TestCleanupCountsFailures(t *testing.T) {
+	s, restore := useMemoryStore(t, "get")
+	defer restore()
+	setup()
+	s.errorRate = 1
+
+	// the cleanup doesn't exit, and reports the failed deletes
+	cleanup()
+
+	if setupFailures != 0 {
+		t.Fatalf("Expected the failures to be reset after they were printed, got %d", setupFailures)
+	}
+	s.errorRate = 0
+	if n := objectCount(t, s); n != len(payloadSizes)*threadsMax {
+		t.Fatalf("Expected all %d objects to be left, got %d", len(payloadSizes)*threadsMax, n)
+	}
+}
+
+func TestReadBodyChecksObject(t *testing.T) {
+	corrupted := make([]byte, 200*1024)
+	corrupted[100*1024] = 1
+
+	for name, body := range map[string][]byte{
+		"a corrupted body": corrupted,
+		"a short body":     make([]byte, 100),
+		"a long body":      make([]byte, 300*1024),
+	} {
+		err := readBody(ioutil.NopCloser(bytes.NewReader(body)), 200*1024)
+		if err == nil || asRequestError(err).class != "checksum" {
+			t.Fatalf("Expected %s to fail with a checksum error, got %v", name, err)
+		}
+	}
+
+	if err := readBody(ioutil.NopCloser(bytes.NewReader(make([]byte, 200*1024))), 200*1024); err != nil {
+		t.Fatalf("Expected the zero bytes of the object to match, got %v", err)
+	}
+}
+
+func TestReadBodyReusesBuffers(t *testing.T) {
+	payload := zeroPayload(4 * 1024 * 1024)
+
+	// warm up the pool of buffers
+	_ = readBody(ioutil.NopCloser(bytes.NewReader(payload)), uint64(len(payload)))
+
+	allocs := startAllocStats()
+	for i := 0; i < 10; i++ {
+		if err := readBody(ioutil.NopCloser(bytes.NewReader(payload)), uint64(len(payload))); err != nil {
+			t.Fatalf("Failed to read the body: %v", err)
+		}
+	}
+	allocs.stop()
+
+	if perRequest, _ := allocs.perRequest(10); perRequest > readBufferSize {
+		t.Fatalf("Expected reading a 4 MB body to allocate less than a read buffer, got %.0f bytes", perRequest)
+	}
+}
+
+func TestParseFlagsStartsFromDefaults(t *testing.T) {
+	parseFlags([]string{"-throttling-mode", "-bucket-name=other", "-region=eu-west-1", "-endpoint=http://localhost:9000"})
+	if !throttlingMode || bucketName != "other" || region != "eu-west-1" || endpoint != "http://localhost:9000" {
+		t.Fatalf("Expected the arguments to be set, got %v, %s, %s and %s", throttlingMode, bucketName, region, endpoint)
+	}
+
+	// the arguments of the next scenario of a plan file don't keep those of the previous one
+	parseFlags(nil)
+	if throttlingMode || bucketName != hostBucketName || region != instanceRegion || endpoint != "" {
+		t.Fatalf("Expected the defaults, got %v, %s, %s and %s", throttlingMode, bucketName, region, endpoint)
+	}
+}
+
+func TestParseFlagsSeedsRandomRequests(t *testing.T) {
+	defer parseFlags(nil)
+	defer func(saved runResults) { run = saved }(run)
+
+	// the same seed repeats the same random numbers
+	draw := func(args []string) []int64 {
+		parseFlags(args)
+		return []int64{rand.Int63(), rand.Int63(), rand.Int63()}
+	}
+	if a, b := draw([]string{"-seed=42"}), draw([]string{"-seed=42"}); !reflect.DeepEqual(a, b) {
+		t.Fatalf("Expected the same numbers with the same seed, got %v and %v", a, b)
+	}
+
+	// without a seed, every run draws other numbers, and records the seed it picked
+	a := draw(nil)
+	startRun("")
+	seed := run.Flags["seed"]
+	if b := draw(nil); reflect.DeepEqual(a, b) {
+		t.Fatalf("Expected other numbers without a seed, got %v twice", a)
+	}
+	if b := draw([]string{"-seed=" + seed}); !reflect.DeepEqual(a, b) {
+		t.Fatalf("Expected the recorded seed %s to repeat %v, got %v", seed, a, b)
+	}
+}
+
+func TestParseSizes(t *testing.T) {
+	tests := []struct {
+		list  string
+		sizes []uint64
+	}{
+		{"4KiB,100KB", []uint64{4096, 100000}},
+		{"1KiB..4KiB*2", []uint64{1024, 2048, 4096}},
+		{"10MB..30MB+10MB,20MB", []uint64{10000000, 20000000, 30000000}},
+		{"0,1KB", []uint64{0, 1000}},
+		{"0..2KB+1KB", []uint64{0, 1000, 2000}},
+
+		// the ranges that would never end, or have no sizes, are rejected
+		{"0..1MiB*2", nil},
+		{"1KiB..1MiB*1", nil},
+		{"1KiB..1MiB*0.5", nil},
+		{"1KiB..1MiB*NaN", nil},
+		{"1KiB..1MiB+0", nil},
+		{"1MiB..1KiB*2", nil},
+		{"1KiB..1MiB", nil},
+		{"", nil},
+	}
+	for _, test := range tests {
+		var sizes []uint64
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			sizes = parseSizes(test.list)
+			return false
+		}()
+
+		if test.sizes == nil {
+			if !panicked {
+				t.Errorf("%s: expected an error, got %v", test.list, sizes)
+			}
+		} else if panicked || fmt.Sprint(sizes) != fmt.Sprint(test.sizes) {
+			t.Errorf("%s: expected %v, got %v", test.list, test.sizes, sizes)
+		}
+	}
+}
+
+func TestParseThreadCounts(t *testing.T) {
+	tests := []struct {
+		list   string
+		counts []int
+	}{
+		{"1,2,4", []int{1, 2, 4}},
+		{"1..16*2", []int{1, 2, 4, 8, 16}},
+		{"8..32+8,16", []int{8, 16, 24, 32}},
+
+		// thread counts of 0 are rejected before a range is expanded
+		{"0..64*2", nil},
+		{"0..64+8", nil},
+		{"0", nil},
+		{"1..64*1", nil},
+		{"1..64+0", nil},
+	}
+	for _, test := range tests {
+		var counts []int
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			counts = parseThreadCounts(test.list)
+			return false
+		}()
+
+		if test.counts == nil {
+			if !panicked {
+				t.Errorf("%s: expected an error, got %v", test.list, counts)
+			}
+		} else if panicked || fmt.Sprint(counts) != fmt.Sprint(test.counts) {
+			t.Errorf("%s: expected %v, got %v", test.list, test.counts, counts)
+		}
+	}
+}
+
+func TestMemoryStoreZeroes(t *testing.T) {
+	s := newMemoryStore()
+	s.zeroes = true
+	ctx := context.Background()
+	if err := s.CreateBucket(ctx, "bucket", ""); err != nil {
+		t.Fatalf("Failed to create the bucket: %v", err)
+	}
+
+	// only the size of the body is kept
+	if err := s.PutObject(ctx, "bucket", "key", bytes.NewReader(bytes.Repeat([]byte("x"), 1000))); err != nil {
+		t.Fatalf("Failed to put the object: %v", err)
+	}
+	body, err := s.GetObject(ctx, "bucket", "key", "bytes=100-199")
+	if err != nil {
+		t.Fatalf("Failed to get the object: %v", err)
+	}
+	content, _ := ioutil.ReadAll(body)
+	if !bytes.Equal(content, make([]byte, 100)) {
+		t.Fatalf("Expected 100 zero bytes, got %q", content)
+	}
+
+	id, _ := s.CreateMultipartUpload(ctx, "bucket", "multipart")
+	first, _ := s.UploadPart(ctx, "bucket", "multipart", id, 1, bytes.NewReader(make([]byte, 300)))
+	second, _ := s.UploadPart(ctx, "bucket", "multipart", id, 2, bytes.NewReader(make([]byte, 200)))
+	if err := s.CompleteMultipartUpload(ctx, "bucket", "multipart", id, []string{first, second}); err != nil {
+		t.Fatalf("Failed to complete the multipart upload: %v", err)
+	}
+	if size, err := s.HeadObject(ctx, "bucket", "multipart"); err != nil || size != 500 {
+		t.Fatalf("Expected an object of 500 bytes, got %d and %v", size, err)
+	}
+}
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		byteRange  string
+		start, end int
+		ok         bool
+	}{
+		{"bytes=0-99", 0, 100, true},
+		{"bytes=100-", 100, 1000, true},
+		{"bytes=-100", 900, 1000, true},
+		{"bytes=900-2000", 900, 1000, true},
+		{"bytes=1000-1001", 0, 0, false},
+		{"bytes=10-5", 0, 0, false},
+	}
+	for _, test := range tests {
+		start, end, ok := parseByteRange(test.byteRange, 1000)
+		if start != test.start || end != test.end || ok != test.ok {
+			t.Errorf("%s: expected %d, %d, %v, got %d, %d, %v", test.byteRange, test.start, test.end, test.ok, start, end, ok)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// an object store that keeps the objects in memory, with a simulated latency, bandwidth and error rate, so that the
+// benchmarks can run without S3
+type memoryStore struct {
+	lock    sync.Mutex
+	buckets map[string]map[string][]byte
+	uploads map[string]*memoryUpload
+	nextID  int
+
+	// the time every request waits before it responds, i.e. the time to first byte
+	latency time.Duration
+
+	// the bandwidth in bytes per second with which every request or response body is transferred, or 0 for no limit,
+	// and the bandwidth of all of them together, if set
+	bandwidth float64
+	shared    *bandwidthLimiter
+
+	// the share of requests that fail, between 0 and 1, and the error they fail with, which is a 503 SlowDown if nil
+	errorRate float64
+	err       error
+
+	// if set, the store only keeps the sizes of the objects, and responds with zero bytes, so that it doesn't need the
+	// memory of all the objects, e.g. for the calibration
+	zeroes bool
+}
+
+// a multipart upload of the in-memory store, with its parts by part number
+type memoryUpload struct {
+	bucket string
+	key    string
+	parts  map[int][]byte
+}
+
+// returns an empty in-memory store without any latency, bandwidth limit or errors
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		buckets: make(map[string]map[string][]byte),
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+// waits for the latency of a request, and returns the injected error if the request fails
+func (s *memoryStore) request(ctx context.Context) error {
+	if s.latency > 0 {
+		select {
+		case <-time.After(s.latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if s.errorRate > 0 && rand.Float64() < s.errorRate {
+		if s.err != nil {
+			return s.err
+		}
+		return errSlowDown()
+	}
+	return nil
+}
+
+// reads a request body at the bandwidth of the store, or only its size if the store keeps zero bytes
+func (s *memoryStore) readBody(body io.Reader) ([]byte, error) {
+	reader := &bandwidthReader{reader: body, bandwidth: s.bandwidth, start: time.Now(), shared: s.shared}
+	if s.zeroes {
+		n, err := io.Copy(ioutil.Discard, reader)
+		return zeroPayload(uint64(n)), err
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// returns the objects of the bucket, which must be called with the lock held
+func (s *memoryStore) bucket(name string) (map[string][]byte, error) {
+	objects, ok := s.buckets[name]
+	if !ok {
+		return nil, errNoSuchBucket()
+	}
+	return objects, nil
+}
+
+// returns the object, which must be called with the lock held
+func (s *memoryStore) object(bucket string, key string) ([]byte, error) {
+	objects, err := s.bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	content, ok := objects[key]
+	if !ok {
+		return nil, errNotFound()
+	}
+	return content, nil
+}
+
+// stores the object, which must be called with the lock held
+func (s *memoryStore) putObject(bucket string, key string, content []byte) error {
+	objects, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	objects[key] = content
+	return nil
+}
+
+func (s *memoryStore) CreateBucket(ctx context.Context, bucket string, region string) error {
+	if err := s.request(ctx); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.buckets[bucket]; ok {
+		return errBucketAlreadyOwnedByYou()
+	}
+	s.buckets[bucket] = make(map[string][]byte)
+	return nil
+}
+
+func (s *memoryStore) GetObject(ctx context.Context, bucket string, key string, byteRange string) (io.ReadCloser, error) {
+	if err := s.request(ctx); err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	content, err := s.object(bucket, key)
+	s.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if byteRange != "" {
+		start, end, ok := parseByteRange(byteRange, len(content))
+		if !ok {
+			return nil, errInvalidRange()
+		}
+		content = content[start:end]
+	}
+
+	return ioutil.NopCloser(&bandwidthReader{reader: bytes.NewReader(content), bandwidth: s.bandwidth, start: time.Now(), shared: s.shared}), nil
+}
+
+func (s *memoryStore) PutObject(ctx context.Context, bucket string, key string, body io.Reader) error {
+	content, err := s.readBody(body)
+	if err != nil {
+		return err
+	}
+	if err := s.request(ctx); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.putObject(bucket, key, content)
+}
+
+func (s *memoryStore) HeadObject(ctx context.Context, bucket string, key string) (int64, error) {
+	if err := s.request(ctx); err != nil {
+		return 0, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	content, err := s.object(bucket, key)
+	return int64(len(content)), err
+}
+
+func (s *memoryStore) CopyObject(ctx context.Context, bucket string, source string, destination string) error {
+	if err := s.request(ctx); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	content, err := s.object(bucket, source)
+	if err != nil {
+		return err
+	}
+	return s.putObject(bucket, destination, content)
+}
+
+func (s *memoryStore) DeleteObject(ctx context.Context, bucket string, key string) error {
+	return s.DeleteObjects(ctx, bucket, []string{key})
+}
+
+func (s *memoryStore) DeleteObjects(ctx context.Context, bucket string, keys []string) error {
+	if err := s.request(ctx); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// like S3, deleting an object that doesn't exist succeeds
+	objects, err := s.bucket(bucket)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		delete(objects, key)
+	}
+	return nil
+}
+
+func (s *memoryStore) ListObjects(ctx context.Context, bucket string, prefix string, maxKeys int, token *string) ([]string, *string, error) {
+	if err := s.request(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	objects, err := s.bucket(bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	for key := range objects {
+		// the continuation token is the last key of the previous page
+		if strings.HasPrefix(key, prefix) && (token == nil || key > *token) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	if len(keys) <= maxKeys {
+		return keys, nil, nil
+	}
+	keys = keys[:maxKeys]
+	next := keys[len(keys)-1]
+	return keys, &next, nil
+}
+
+func (s *memoryStore) CreateMultipartUpload(ctx context.Context, bucket string, key string) (string, error) {
+	if err := s.request(ctx); err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.bucket(bucket); err != nil {
+		return "", err
+	}
+
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.uploads[id] = &memoryUpload{bucket: bucket, key: key, parts: make(map[int][]byte)}
+	return id, nil
+}
+
+func (s *memoryStore) UploadPart(ctx context.Context, bucket string, key string, uploadID string, partNumber int, body io.Reader) (string, error) {
+	content, err := s.readBody(body)
+	if err != nil {
+		return "", err
+	}
+	if err := s.request(ctx); err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.bucket != bucket || upload.key != key {
+		return "", errNoSuchUpload()
+	}
+	upload.parts[partNumber] = content
+	return fmt.Sprintf("\"%x\"", md5.Sum(content)), nil
+}
+
+func (s *memoryStore) CompleteMultipartUpload(ctx context.Context, bucket string, key string, uploadID string, etags []string) error {
+	if err := s.request(ctx); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.bucket != bucket || upload.key != key {
+		return errNoSuchUpload()
+	}
+
+	size := 0
+	for i, etag := range etags {
+		part, ok := upload.parts[i+1]
+		if !ok || etag != fmt.Sprintf("\"%x\"", md5.Sum(part)) {
+			return errInvalidPart()
+		}
+		size += len(part)
+	}
+
+	content := zeroPayload(uint64(size))
+	if !s.zeroes {
+		content = make([]byte, 0, size)
+		for i := range etags {
+			content = append(content, upload.parts[i+1]...)
+		}
+	}
+
+	delete(s.uploads, uploadID)
+	return s.putObject(bucket, key, content)
+}
+
+func (s *memoryStore) AbortMultipartUpload(ctx context.Context, bucket string, key string, uploadID string) error {
+	if err := s.request(ctx); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+// parses an HTTP byte range of a single range, e.g. "bytes=0-99", and returns the start and the exclusive end of the
+// range within an object of the given size, and whether the range is valid
+func parseByteRange(byteRange string, size int) (int, int, bool) {
+	bounds := strings.SplitN(strings.TrimPrefix(byteRange, "bytes="), "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+
+	// a suffix range, e.g. "bytes=-100" for the last 100 bytes
+	if bounds[0] == "" {
+		n, err := strconv.Atoi(bounds[1])
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size, true
+	}
+
+	start, err := strconv.Atoi(bounds[0])
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+
+	// an open range, e.g. "bytes=100-" from the byte at offset 100 to the end
+	end := size - 1
+	if bounds[1] != "" {
+		end, err = strconv.Atoi(bounds[1])
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end + 1, true
+}
+
+// a reader that doesn't read faster than the given bandwidth in bytes per second, or 0 for no limit, and than the
+// bandwidth it shares with other readers, if any
+type bandwidthReader struct {
+	reader    io.Reader
+	bandwidth float64
+	start     time.Time
+	read      int64
+	shared    *bandwidthLimiter
+}
+
+func (r *bandwidthReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	// wait until the bytes read so far fit into the bandwidth since the start
+	if r.bandwidth > 0 {
+		due := r.start.Add(time.Duration(float64(r.read) / r.bandwidth * float64(time.Second)))
+		time.Sleep(due.Sub(time.Now()))
+	}
+
+	if r.shared != nil {
+		r.shared.wait(n)
+	}
+	return n, err
+}
+
+// a bandwidth in bytes per second that is shared by several readers, e.g. all the requests of a server
+type bandwidthLimiter struct {
+	lock      sync.Mutex
+	bandwidth float64
+
+	// the time when the bytes read so far fit into the bandwidth
+	next time.Time
+}
+
+// waits until the given number of bytes fit into the bandwidth, after the bytes read before
+func (l *bandwidthLimiter) wait(n int) {
+	l.lock.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.bandwidth * float64(time.Second)))
+	due := l.next
+	l.lock.Unlock()
+
+	time.Sleep(due.Sub(now))
+}
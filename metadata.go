@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/schollz/progressbar/v2"
+	"sync"
+	"time"
+)
+
+// the continuation tokens of the list benchmark, so that every thread pages through its prefix across samples
+var listTokens = make(map[int]*string)
+var listTokensLock sync.Mutex
+
+// does a HeadObject request for the object of the given thread index and size, and measures its latency
+func headObject(threadIndex int, payloadSize uint64) (latency, error) {
+	// generate an S3 key from the sha hash of the hostname, thread index, and object size
+	key := generateS3Key(hostname, threadIndex, payloadSize)
+
+	// start the timer to measure the latency
+	latencyTimer := time.Now()
+
+	// do the HeadObject request
+	ctx, trace := traceRequest()
+	_, err := store.HeadObject(ctx, bucketName, key)
+
+	// if a request fails, fail the sample
+	if err != nil {
+		return latency{}, failRequest("Failed to head object", err)
+	}
+
+	// there's no body, so the first byte and last byte latencies are the same
+	elapsed := time.Now().Sub(latencyTimer)
+
+	return trace.finish(latency{FirstByte: elapsed, LastByte: elapsed}, latencyTimer), nil
+}
+
+// copies the object of the given thread index and size to another key within the bucket, and measures the latency
+func copyObject(threadIndex int, payloadSize uint64) (latency, error) {
+	// the source object, and a destination object that is specific to this thread
+	source := generateS3Key(hostname, threadIndex, payloadSize)
+	destination := generateS3Key(hostname+"-copy", threadIndex, payloadSize)
+
+	// start the timer to measure the latency
+	latencyTimer := time.Now()
+
+	// do the CopyObject request
+	ctx, trace := traceRequest()
+	err := store.CopyObject(ctx, bucketName, source, destination)
+
+	// if a request fails, fail the sample
+	if err != nil {
+		return latency{}, failRequest("Failed to copy object", err)
+	}
+
+	// the response is only sent once the copy is done, so the first byte and last byte latencies are the same
+	elapsed := time.Now().Sub(latencyTimer)
+
+	return trace.finish(latency{FirstByte: elapsed, LastByte: elapsed}, latencyTimer), nil
+}
+
+// returns the keys of the objects deleted by every request of the delete benchmark, which are specific to the thread
+func deleteKeys(threadIndex int, payloadSize uint64) []string {
+	keys := make([]string, deleteBatch)
+	for i := range keys {
+		keys[i] = generateS3Key(fmt.Sprintf("%s-delete-%d", hostname, i), threadIndex, payloadSize)
+	}
+	return keys
+}
+
+// uploads the objects of the given size that the next request of the delete benchmark deletes, which isn't part of
+// the measurement
+func uploadDeleteBatch(threadIndex int, payloadSize uint64) error {
+	for _, key := range deleteKeys(threadIndex, payloadSize) {
+		err := store.PutObject(context.Background(), bucketName, key, bytes.NewReader(zeroPayload(payloadSize)))
+
+		// if the put fails, the batch can't be deleted
+		if err != nil {
+			return failRequest("Failed to put S3 object", err)
+		}
+	}
+	return nil
+}
+
+// measures the latency of deleting the objects uploaded by uploadDeleteBatch with a single DeleteObject request, or a
+// DeleteObjects request if the delete batch is larger than one object
+func deleteObjects(threadIndex int, payloadSize uint64) (latency, error) {
+	keys := deleteKeys(threadIndex, payloadSize)
+
+	if deleteBatch == 1 {
+		return deleteObject(keys[0])
+	}
+
+	// start the timer to measure the latency
+	latencyTimer := time.Now()
+
+	// do the DeleteObjects request
+	ctx, trace := traceRequest()
+	err := store.DeleteObjects(ctx, bucketName, keys)
+
+	// if a request fails, or any of the objects can't be deleted, fail the sample
+	if err != nil {
+		return latency{}, failRequest("Failed to delete objects", err)
+	}
+
+	// the response is only sent once the objects are deleted, so the first byte and last byte latencies are the same
+	elapsed := time.Now().Sub(latencyTimer)
+
+	return trace.finish(latency{FirstByte: elapsed, LastByte: elapsed}, latencyTimer), nil
+}
+
+// deletes the object with the given key with a DeleteObject request, and measures the latency
+func deleteObject(key string) (latency, error) {
+	// start the timer to measure the latency
+	latencyTimer := time.Now()
+
+	// do the DeleteObject request
+	ctx, trace := traceRequest()
+	err := store.DeleteObject(ctx, bucketName, key)
+
+	// if a request fails, fail the sample
+	if err != nil {
+		return latency{}, failRequest("Failed to delete object", err)
+	}
+
+	// the response has no body, so the first byte and last byte latencies are the same
+	elapsed := time.Now().Sub(latencyTimer)
+
+	return trace.finish(latency{FirstByte: elapsed, LastByte: elapsed}, latencyTimer), nil
+}
+
+// lists the next page of the key prefix of the given thread index, and measures the latency
+func listObjects(threadIndex int, payloadSize uint64) (latency, error) {
+	// every thread lists one of the prefixes, and continues where its previous request ended
+	prefix := listPrefix((threadIndex - 1) % listPrefixes)
+
+	listTokensLock.Lock()
+	token := listTokens[threadIndex]
+	listTokensLock.Unlock()
+
+	// start the timer to measure the latency
+	latencyTimer := time.Now()
+
+	// do the ListObjectsV2 request
+	ctx, trace := traceRequest()
+	_, next, err := store.ListObjects(ctx, bucketName, prefix, listPageSize, token)
+
+	// if a request fails, fail the sample
+	if err != nil {
+		return latency{}, failRequest("Failed to list objects", err)
+	}
+
+	// the response is parsed as a whole, so the first byte and last byte latencies are the same
+	elapsed := time.Now().Sub(latencyTimer)
+
+	// start over from the first page once the last page was listed
+	listTokensLock.Lock()
+	if next != nil {
+		listTokens[threadIndex] = next
+	} else {
+		delete(listTokens, threadIndex)
+	}
+	listTokensLock.Unlock()
+
+	return trace.finish(latency{FirstByte: elapsed, LastByte: elapsed}, latencyTimer), nil
+}
+
+// returns the key prefix with the given index listed by the list benchmark
+func listPrefix(index int) string {
+	return fmt.Sprintf("%slist-%s/%03d/", keyPrefix, hostname, index)
+}
+
+// uploads the empty objects listed by the list benchmark, unless they already exist from a previous test run
+func setupListObjects() {
+	fmt.Fprintf(console, "Uploading \033[1;33m%d\033[0m objects under \033[1;33m%d\033[0m prefixes\n", listObjectCount, listPrefixes)
+
+	// create a progress bar
+	bar := progressbar.NewOptions(listPrefixes*listObjectCount-1, progressbar.OptionSetRenderBlankState(true))
+
+	for p := 0; p < listPrefixes; p++ {
+		// find the objects that already exist under this prefix, or else upload all of them
+		existing := make(map[string]bool)
+		setupRequest(func() error {
+			keys, err := listAllKeys(listPrefix(p))
+			for _, key := range keys {
+				existing[key] = true
+			}
+			return err
+		})
+
+		for n := 0; n < listObjectCount; n++ {
+			// increment the progress bar for each object
+			_ = bar.Add(1)
+
+			key := fmt.Sprintf("%s%06d", listPrefix(p), n)
+			if existing[key] {
+				continue
+			}
+
+			// do a PutObject request to create an empty object
+			setupRequest(func() error {
+				err := store.PutObject(context.Background(), bucketName, key, bytes.NewReader(nil))
+
+				// if the put fails, fail
+				if err != nil {
+					return failRequest("Failed to put S3 object", err)
+				}
+				return nil
+			})
+		}
+	}
+
+	fmt.Fprint(console, "\n")
+
+	// the objects that couldn't be uploaded are missing from the listings
+	printSetupFailures("upload")
+}
+
+// deletes all the objects listed by the list benchmark
+func cleanupListObjects() {
+	var keys []string
+	setupRequest(func() (err error) {
+		keys, err = listAllKeys(fmt.Sprintf("%slist-%s/", keyPrefix, hostname))
+		return err
+	})
+
+	deleteAllKeys(keys)
+}
+
+// deletes the keys in batches of the maximum size allowed by DeleteObjects, where keys that don't exist count as deleted
+func deleteAllKeys(keys []string) {
+	for start := 0; start < len(keys); start += 1000 {
+		end := start + 1000
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		setupRequest(func() error {
+			err := store.DeleteObjects(context.Background(), bucketName, keys[start:end])
+
+			// if the request fails, fail
+			if err != nil {
+				return failRequest("Failed to delete objects", err)
+			}
+			return nil
+		})
+	}
+}
+
+// returns all the keys with the given prefix, or the keys listed so far and the error if a request failed
+func listAllKeys(prefix string) ([]string, error) {
+	var keys []string
+	var token *string
+
+	for {
+		page, next, err := store.ListObjects(context.Background(), bucketName, prefix, 0, token)
+
+		// if the request fails, fail
+		if err != nil {
+			return keys, failRequest("Failed to list objects", err)
+		}
+
+		keys = append(keys, page...)
+
+		if next == nil {
+			return keys, nil
+		}
+		token = next
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// the upper bounds in seconds of the buckets of the latency histograms of the metrics endpoint
+var metricsBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// the labels of the metrics of the requests of one operation, payload size and thread count
+type metricsLabels struct {
+	operation   string
+	payloadSize uint64
+	threads     int
+}
+
+// a latency histogram with the fixed buckets of the metrics endpoint, in the format of Prometheus
+type metricsHistogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// the metrics of the requests of one operation, payload size and thread count
+type metricsSeries struct {
+	firstByte metricsHistogram
+	lastByte  metricsHistogram
+	requests  uint64
+	errors    uint64
+
+	// the throughput and request rate of the last test that finished
+	throughput  float64
+	requestRate float64
+}
+
+// the address the metrics endpoint listens on, or empty if it is disabled
+var metricsAddress string
+
+// the metrics of every operation, payload size and thread count, which are kept for the whole run so that counters
+// never go down
+var metricsLock sync.Mutex
+var metrics = make(map[metricsLabels]*metricsSeries)
+
+// starts the HTTP server of the metrics endpoint in the background, if the metrics address argument is set, and fails
+// right away if it can't listen on the address
+func startMetricsServer() {
+	if metricsAddress == "" {
+		return
+	}
+
+	listener, err := net.Listen("tcp", metricsAddress)
+	if err != nil {
+		panic("Failed to listen on " + metricsAddress + " for the metrics: " + err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+
+	go func() { _ = http.Serve(listener, mux) }()
+
+	fmt.Fprintf(console, "Serving metrics at \033[1;33mhttp://%s/metrics\033[0m\n", metricsAddress)
+}
+
+// returns the series of the given labels, creating it if needed, which must be called with the lock held
+func metricsSeriesOf(labels metricsLabels) *metricsSeries {
+	series, ok := metrics[labels]
+	if !ok {
+		series = &metricsSeries{
+			firstByte: metricsHistogram{buckets: make([]uint64, len(metricsBuckets))},
+			lastByte:  metricsHistogram{buckets: make([]uint64, len(metricsBuckets))},
+		}
+		metrics[labels] = series
+	}
+	return series
+}
+
+// adds the latencies of a request to the metrics, if the metrics endpoint is enabled
+func observeRequest(operation string, payloadSize uint64, threads int, timing latency) {
+	if metricsAddress == "" {
+		return
+	}
+
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	series := metricsSeriesOf(metricsLabels{operation: operation, payloadSize: payloadSize, threads: threads})
+	series.requests++
+	series.firstByte.observe(timing.FirstByte)
+	series.lastByte.observe(timing.LastByte)
+}
+
+// counts a request that failed even after retrying in the metrics, if the metrics endpoint is enabled
+func observeError(operation string, payloadSize uint64, threads int) {
+	if metricsAddress == "" {
+		return
+	}
+
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	series := metricsSeriesOf(metricsLabels{operation: operation, payloadSize: payloadSize, threads: threads})
+	series.requests++
+	series.errors++
+}
+
+// sets the throughput gauges of the metrics to the results of a test, and to those of every operation of the mixed
+// benchmark, if the metrics endpoint is enabled
+func observeResult(r result) {
+	if metricsAddress == "" {
+		return
+	}
+
+	threads := r.Threads
+	if r.PartThreads > 0 {
+		threads = r.PartThreads
+	}
+
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	for _, o := range withOperations(r) {
+		series := metricsSeriesOf(metricsLabels{operation: o.Operation, payloadSize: o.ObjectSize, threads: threads})
+		series.throughput = o.Throughput * 1024 * 1024
+		series.requestRate = o.RequestRate
+	}
+}
+
+// adds a latency to the histogram
+func (h *metricsHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, bound := range metricsBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// writes all the metrics in the text format of Prometheus
+func writeMetrics(w io.Writer) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	// sort the series, so that the output is stable between scrapes
+	var keys []metricsLabels
+	for labels := range metrics {
+		keys = append(keys, labels)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		if keys[i].payloadSize != keys[j].payloadSize {
+			return keys[i].payloadSize < keys[j].payloadSize
+		}
+		return keys[i].threads < keys[j].threads
+	})
+
+	histograms := []struct {
+		name string
+		help string
+		get  func(*metricsSeries) *metricsHistogram
+	}{
+		{"s3bench_first_byte_seconds", "The time to the first byte of the requests.", func(s *metricsSeries) *metricsHistogram { return &s.firstByte }},
+		{"s3bench_last_byte_seconds", "The time to the last byte of the requests.", func(s *metricsSeries) *metricsHistogram { return &s.lastByte }},
+	}
+	for _, m := range histograms {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", m.name, m.help, m.name)
+		for _, labels := range keys {
+			h := m.get(metrics[labels])
+			cumulative := uint64(0)
+			for i, bound := range metricsBuckets {
+				cumulative += h.buckets[i]
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", m.name, labels, strconv.FormatFloat(bound, 'f', -1, 64), cumulative)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", m.name, labels, h.count)
+			fmt.Fprintf(w, "%s_sum{%s} %g\n", m.name, labels, h.sum)
+			fmt.Fprintf(w, "%s_count{%s} %d\n", m.name, labels, h.count)
+		}
+	}
+
+	values := []struct {
+		name string
+		kind string
+		help string
+		get  func(*metricsSeries) float64
+	}{
+		{"s3bench_requests_total", "counter", "The number of requests that finished.", func(s *metricsSeries) float64 { return float64(s.requests) }},
+		{"s3bench_errors_total", "counter", "The number of requests that failed.", func(s *metricsSeries) float64 { return float64(s.errors) }},
+		{"s3bench_throughput_bytes_per_second", "gauge", "The throughput of the last test that finished.", func(s *metricsSeries) float64 { return s.throughput }},
+		{"s3bench_requests_per_second", "gauge", "The request rate of the last test that finished.", func(s *metricsSeries) float64 { return s.requestRate }},
+	}
+	for _, m := range values {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, labels := range keys {
+			fmt.Fprintf(w, "%s{%s} %g\n", m.name, labels, m.get(metrics[labels]))
+		}
+	}
+}
+
+// formats the labels in the text format of Prometheus
+func (l metricsLabels) String() string {
+	return fmt.Sprintf("operation=%q,payload_size=\"%d\",threads=\"%d\"", l.operation, l.payloadSize, l.threads)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the operations of the mixed benchmark, in the order of the weights of the mix argument
+var mixedOperations = []string{"get", "put", "head", "delete"}
+
+// parses the weights of the mix argument, e.g. "70:20:10", where missing weights are 0
+func parseMix(mix string) []int {
+	parts := strings.Split(mix, ":")
+	if len(parts) > len(mixedOperations) {
+		panic("The mix argument has more weights than operations: " + mix)
+	}
+
+	weights := make([]int, len(mixedOperations))
+	total := 0
+	for i, part := range parts {
+		weight, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || weight < 0 {
+			panic("Invalid weight in the mix argument: " + mix)
+		}
+		weights[i] = weight
+		total += weight
+	}
+
+	if total == 0 {
+		panic("The mix argument needs at least one positive weight: " + mix)
+	}
+
+	return weights
+}
+
+// picks an operation according to the weights of the mix argument, and performs it on objects of the given thread
+// index and size
+func mixedOperation(threadIndex int, payloadSize uint64) (latency, error) {
+	total := 0
+	for _, weight := range mixWeights {
+		total += weight
+	}
+
+	// find the operation that the random number falls into
+	n := rand.Intn(total)
+	operation := mixedOperations[len(mixedOperations)-1]
+	for i, weight := range mixWeights {
+		if n < weight {
+			operation = mixedOperations[i]
+			break
+		}
+		n -= weight
+	}
+
+	// the objects read by get and head are never overwritten or deleted, so the writes use another key
+	scratchKey := generateS3Key(hostname+"-mixed", threadIndex, payloadSize)
+
+	var result latency
+	var err error
+	switch operation {
+	case "get":
+		result, err = getObject(threadIndex, payloadSize)
+	case "put":
+		result, err = putObjectKey(scratchKey, payloadSize)
+	case "head":
+		result, err = headObject(threadIndex, payloadSize)
+	case "delete":
+		result, err = deleteObject(scratchKey)
+	}
+
+	// the operation is kept for failed requests too, so that their errors are counted for the right operation
+	result.Operation = operation
+	return result, err
+}
+
+// the latencies of one operation of the mixed benchmark
+type operationRecord struct {
+	firstByte histogram
+	lastByte  histogram
+}
+
+// adds the latencies of a result of the mixed benchmark to the record of its operation
+func recordOperation(records map[string]*operationRecord, timing latency) {
+	record, ok := records[timing.Operation]
+	if !ok {
+		record = &operationRecord{}
+		records[timing.Operation] = record
+	}
+	record.firstByte.record(timing.FirstByte)
+	record.lastByte.record(timing.LastByte)
+}
+
+// whether the operation of the mixed benchmark transfers the payload
+func transfersPayload(operation string) bool {
+	return operation == "get" || operation == "put"
+}
+
+// prints a row with the request rate and latencies of every operation of the mixed benchmark
+func printMixedResults(records map[string]*operationRecord, totalTime time.Duration) {
+	for _, operation := range mixedOperations {
+		// skip the operations that weren't picked at all
+		record, ok := records[operation]
+		if !ok {
+			continue
+		}
+
+		rate := float64(record.firstByte.count) / totalTime.Seconds()
+
+		fmt.Fprintf(console, "| %7s | %9.1f op/s |         |           |         |       |           |                 |       |%s|%s|\n",
+			operation, rate, statsColumn(record.firstByte.summary()), statsColumn(record.lastByte.summary()))
+	}
+}
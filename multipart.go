@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// runs the multipart upload benchmark for every object size, part size and part thread count
+func runMultipartBenchmark() {
+	runPartsBenchmark("Multipart upload", "Part Upload Time (ms)", "Complete Upload Time (ms)", execMultipartTest)
+}
+
+// runs a benchmark that splits objects into parts for every object size, part size and part thread count, using the
+// given function to test a single combination
+func runPartsBenchmark(title string, firstTitle string, secondTitle string, test func(objectSize uint64, partSize uint64, partThreads int, csvRecords [][]string) [][]string) {
+	fmt.Fprint(console, "\n--- \033[1;32mBENCHMARK\033[0m ----------------------------------------------------------------------------------------------------------------\n\n")
+
+	// array of csv records used to upload the results to S3 when the test is finished
+	var csvRecords [][]string
+
+	// loop over every payload size
+	for _, payload := range payloadSizes {
+		// print the header for the benchmark of this object size
+		printPartsHeader(title, payload, firstTitle, secondTitle)
+
+		// run a test per part size and part thread count, doubling both on every iteration
+		for partSize := partSizeMin; partSize <= partSizeMax; partSize *= 2 {
+			// parts larger than the object all result in a single part, so only test the smallest one
+			if partSize > payload && partSize != partSizeMin {
+				break
+			}
+
+			for t := partThreadsMin; t <= partThreadsMax; t *= 2 {
+				csvRecords = test(payload, partSize, t, csvRecords)
+			}
+		}
+		partsTable.printFooter()
+	}
+
+	// if the csv option is true, upload the csv results to S3
+	if csvResults != "" {
+		uploadCsvResults(csvRecords)
+	}
+}
+
+// uploads objects of the given size with multipart uploads, one object at a time, and prints the results
+func execMultipartTest(objectSize uint64, partSize uint64, partThreads int, csvRecords [][]string) [][]string {
+	// this overrides the sample count on small hosts that can get overwhelmed by a large throughput
+	samples := getTargetSampleCount(partThreads, samples)
+
+	// generate an empty payload that is shared by all the parts
+	payload := zeroPayload(objectSize)
+
+	// generate an S3 key from the sha hash of the hostname, thread index, and object size
+	key := generateS3Key(hostname, 1, objectSize)
+
+	var partLatencies, completeLatencies histogram
+
+	// the objects that failed to upload, which don't count as samples
+	var failures errorCounts
+
+	// start the timer for this benchmark, and count the allocations of the client
+	allocs := startAllocStats()
+	resources := startTelemetry()
+	benchmarkTimer := time.Now()
+
+	objects := 0
+	for n := 0; !benchmarkConfig().testDone(n, samples, objectSize, benchmarkTimer); n++ {
+		parts, complete := uploadMultipartObject(key, payload, partSize, partThreads)
+		for _, part := range parts {
+			if part.Failure != nil {
+				observeError(mode, objectSize, partThreads)
+				continue
+			}
+			partLatencies.record(part.LastByte)
+			observeRequest(mode, objectSize, partThreads, part)
+		}
+
+		failures.record(complete)
+		if complete.Failure == nil {
+			completeLatencies.record(complete.LastByte)
+			objects++
+		}
+	}
+
+	// stop the timer for this benchmark
+	totalTime := time.Now().Sub(benchmarkTimer)
+	allocs.stop()
+	resources.stop()
+
+	// there are no latencies to summarize if every upload failed, which only stops the benchmark with fail-fast
+	failures.checkSamples(objects)
+
+	return printPartsResult(objectSize, partSize, partThreads, objects, totalTime, partLatencies.summary(), completeLatencies.summary(), failures, allocs, resources, csvRecords)
+}
+
+// uploads the payload with a multipart upload using the given part size and number of parallel part uploads, and
+// returns the latencies of every part upload and of the complete call, where the latter has the error and the retries
+// of the whole upload
+func uploadMultipartObject(key string, payload []byte, partSize uint64, partThreads int) ([]latency, latency) {
+	// start the multipart upload
+	var uploadID string
+	failure, retried := tryRequest(func() error {
+		var err error
+		uploadID, err = store.CreateMultipartUpload(context.Background(), bucketName, key)
+
+		// if the request fails, fail the upload
+		if err != nil {
+			return failRequest("Failed to create multipart upload", err)
+		}
+		return nil
+	})
+	if failure != nil {
+		return nil, latency{Failure: failure, Retries: retried}
+	}
+
+	objectSize := uint64(len(payload))
+	count := partCount(objectSize, partSize)
+
+	// a channel to submit the part numbers to upload
+	partNumbers := make(chan int, count)
+	for n := 1; n <= count; n++ {
+		partNumbers <- n
+	}
+	close(partNumbers)
+
+	// the results of every part, indexed by part number - 1
+	latencies := make([]latency, count)
+	etags := make([]string, count)
+
+	// upload the parts in parallel
+	var wg sync.WaitGroup
+	for w := 1; w <= partThreads && w <= count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range partNumbers {
+				// the byte range of the payload for this part
+				start := uint64(n-1) * partSize
+				end := start + partSize
+				if end > objectSize {
+					end = objectSize
+				}
+
+				latencies[n-1].Failure, latencies[n-1].Retries = tryRequest(func() error {
+					body := &timedReader{reader: bytes.NewReader(payload[start:end])}
+
+					// start the timer to measure the request sent and response latencies
+					latencyTimer := time.Now()
+
+					// do the UploadPart request
+					etag, err := store.UploadPart(context.Background(), bucketName, key, uploadID, n, body)
+
+					// if the request fails, fail the part
+					if err != nil {
+						return failRequest("Failed to upload part", err)
+					}
+
+					// measure the response latency
+					response := time.Now().Sub(latencyTimer)
+
+					latencies[n-1].FirstByte, latencies[n-1].LastByte = body.sentAfter(latencyTimer, response), response
+					etags[n-1] = etag
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the upload fails if any of its parts failed
+	failure, partRetries := partsFailure(latencies)
+	retried += partRetries
+	if failure != nil {
+		abortMultipartUpload(key, uploadID)
+		return latencies, latency{Failure: failure, Retries: retried}
+	}
+
+	// complete the multipart upload, and measure the latency of the last try
+	var complete time.Duration
+	failure, completeRetries := tryRequest(func() error {
+		completeTimer := time.Now()
+
+		err := store.CompleteMultipartUpload(context.Background(), bucketName, key, uploadID, etags)
+
+		// if the request fails, fail the upload
+		if err != nil {
+			return failRequest("Failed to complete multipart upload", err)
+		}
+
+		complete = time.Now().Sub(completeTimer)
+		return nil
+	})
+	retried += completeRetries
+	if failure != nil {
+		abortMultipartUpload(key, uploadID)
+	}
+
+	return latencies, latency{LastByte: complete, Failure: failure, Retries: retried}
+}
+
+// aborts a multipart upload that failed, so that its parts don't take up storage, ignoring any error since S3 also
+// expires incomplete uploads with a lifecycle rule
+func abortMultipartUpload(key string, uploadID string) {
+	_ = store.AbortMultipartUpload(context.Background(), bucketName, key, uploadID)
+}
+
+// returns the number of parts needed to split an object of the given size into parts of the given size
+func partCount(objectSize uint64, partSize uint64) int {
+	if objectSize == 0 {
+		return 1
+	}
+	return int((objectSize + partSize - 1) / partSize)
+}
+
+// prints the table header for the results of the benchmarks that split objects into parts
+func printPartsHeader(title string, objectSize uint64, firstTitle string, secondTitle string) {
+	// instance type string used to render results to stdout
+	instanceTypeString := ""
+
+	if instanceType != "" {
+		instanceTypeString = " (" + instanceType + ")"
+	}
+
+	// print the table header
+	fmt.Fprintf(console, "%s performance with \033[1;33m%-s\033[0m objects%s\n", title, byteFormat(float64(objectSize)), instanceTypeString)
+	partsTable.printHeader(firstTitle, secondTitle)
+}
+
+// prints the results of one part size and part thread count combination, and adds them to the csv records
+func printPartsResult(objectSize uint64, partSize uint64, partThreads int, objects int, totalTime time.Duration, first summary, second summary, failures errorCounts, allocs *allocStats, resources *telemetry, csvRecords [][]string) [][]string {
+	// calculate the end-to-end throughput rate of the whole objects
+	rate := float64(objectSize) * float64(objects) / totalTime.Seconds() / 1024 / 1024
+
+	// print the results to stdout
+	fmt.Fprintf(console, "| %9s | %5d | %7d | \033[1;31m%9.1f MB/s\033[0m | %6.1f%% |%s|%s|%s|%s|\n",
+		byteFormat(float64(partSize)), partCount(objectSize, partSize), partThreads, rate, failures.percent(objects),
+		allocs.columns(objects+int(failures.total())), resources.columns(), statsColumn(first), statsColumn(second))
+	failures.printAllFailed(objects)
+
+	// add the results to the structured results and the csv records
+	r := result{
+		ObjectSize:  objectSize,
+		PartSize:    partSize,
+		Threads:     1,
+		PartThreads: partThreads,
+		Samples:     objects,
+		Bytes:       objectSize * uint64(objects),
+		Seconds:     totalTime.Seconds(),
+		Throughput:  rate,
+		RequestRate: float64(objects) / totalTime.Seconds(),
+		FirstByte:   first.stats(),
+		LastByte:    second.stats(),
+	}
+	r.setErrors(failures)
+	r.setAllocations(allocs, objects+int(failures.total()))
+	r.setTelemetry(resources)
+	return recordResult(r, csvRecords)
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// the version of the schema of the json and ndjson results, which is incremented on incompatible changes
+const resultsSchemaVersion = 1
+
+// the version of this tool, which can be set when building with -ldflags "-X main.version=1.2.3"
+var version = "dev"
+
+// where the results table and the progress of the benchmark are printed, which is stderr if the structured results
+// are written to stdout
+var console io.Writer = os.Stdout
+
+// the metadata and results of a whole benchmark run, as written to json and ndjson results
+type runResults struct {
+	Type          string            `json:"type,omitempty"`
+	SchemaVersion int               `json:"schema_version"`
+	ToolVersion   string            `json:"tool_version"`
+	RunID         string            `json:"run_id"`
+	StartTime     time.Time         `json:"start_time"`
+	Hostname      string            `json:"hostname"`
+	InstanceType  string            `json:"instance_type"`
+	Endpoint      string            `json:"endpoint"`
+	Region        string            `json:"region"`
+	Bucket        string            `json:"bucket"`
+	Mode          string            `json:"mode"`
+	Scenario      string            `json:"scenario,omitempty"`
+	LatencyTitles []string          `json:"latency_titles"`
+	Percentiles   []float64         `json:"percentiles"`
+	Flags         map[string]string `json:"flags"`
+	Results       []result          `json:"results,omitempty"`
+
+	// the runs of every scenario of a plan file, which have the results instead
+	Scenarios []runResults `json:"scenarios,omitempty"`
+}
+
+// the results of one benchmark record, which is one row of the results table
+type result struct {
+	Type        string    `json:"type,omitempty"`
+	Time        time.Time `json:"time"`
+	Scenario    string    `json:"scenario,omitempty"`
+	Operation   string    `json:"operation"`
+	ObjectSize  uint64    `json:"object_size"`
+	PartSize    uint64    `json:"part_size,omitempty"`
+	Threads     int       `json:"threads"`
+	PartThreads int       `json:"part_threads,omitempty"`
+	Run         int       `json:"run,omitempty"`
+	Samples     int       `json:"samples"`
+	Bytes       uint64    `json:"bytes"`
+	Seconds     float64   `json:"seconds"`
+	Throughput  float64   `json:"throughput_mb_per_second"`
+	RequestRate float64   `json:"requests_per_second"`
+
+	// the objects deleted per second by the delete benchmark, if every request deletes a batch of objects
+	ObjectRate float64 `json:"objects_per_second,omitempty"`
+
+	// the request rate and throughput of the calibration of the object size, with the calibrate argument
+	CeilingRequestRate float64 `json:"client_ceiling_requests_per_second,omitempty"`
+	CeilingThroughput  float64 `json:"client_ceiling_mb_per_second,omitempty"`
+
+	// the requests that failed even after retrying, which aren't samples, by error class, and the number of retries
+	Errors       uint64            `json:"errors"`
+	ErrorPercent float64           `json:"error_percent"`
+	ErrorClasses map[string]uint64 `json:"error_classes,omitempty"`
+	Retries      uint64            `json:"retries"`
+
+	// the memory allocated by the client per request, or per object in the benchmarks that split objects into parts,
+	// and its garbage collections during the test
+	AllocBytesPerRequest float64 `json:"alloc_bytes_per_request"`
+	AllocsPerRequest     float64 `json:"allocs_per_request"`
+	GCCycles             uint32  `json:"gc_cycles"`
+	GCPauseMs            float64 `json:"gc_pause_ms"`
+	GCPauseMaxMs         float64 `json:"gc_pause_max_ms"`
+
+	// the CPU usage of the host and the peak memory of the client during the test, the bytes it received and sent
+	// over the network, and whether its cpu or nic was the bottleneck, which are only measured on Linux
+	CPUPercent    float64 `json:"cpu_percent"`
+	CPUPercentMax float64 `json:"cpu_percent_max"`
+	RSSBytes      uint64  `json:"rss_bytes"`
+	NICRxBytes    uint64  `json:"nic_rx_bytes"`
+	NICTxBytes    uint64  `json:"nic_tx_bytes"`
+	ClientBound   string  `json:"client_bound,omitempty"`
+
+	// the two latency columns of the results table, which are named by the latency titles of the run
+	FirstByte latencyStats `json:"first_byte_ms"`
+	LastByte  latencyStats `json:"last_byte_ms"`
+
+	// the results of every operation of the mixed benchmark
+	Operations map[string]operationResult `json:"operations,omitempty"`
+
+	// the latencies of the phases of the HTTP requests, and the share of reused connections, with the trace argument
+	Phases            map[string]latencyStats `json:"phases_ms,omitempty"`
+	ReusedConnections float64                 `json:"reused_connections,omitempty"`
+}
+
+// the results of one operation of the mixed benchmark
+type operationResult struct {
+	Samples     int          `json:"samples"`
+	RequestRate float64      `json:"requests_per_second"`
+	FirstByte   latencyStats `json:"first_byte_ms"`
+	LastByte    latencyStats `json:"last_byte_ms"`
+}
+
+// the summary statistics of some latencies in milliseconds, as written to json and ndjson results
+type latencyStats struct {
+	Count       uint64             `json:"count"`
+	Avg         float64            `json:"avg"`
+	Stddev      float64            `json:"stddev"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Percentiles map[string]float64 `json:"percentiles"`
+}
+
+// the format of the structured results, which is either json, ndjson, csv, or table for none
+var outputFormat string
+
+// the file the structured results are written to, or - for stdout
+var outputFile string
+
+// the run metadata, and the results collected so far for json results
+var run runResults
+
+// the finished runs of the scenarios of a plan file, for json results
+var planRuns []runResults
+
+// the writer of the structured results
+var output *bufio.Writer
+var outputCloser io.Closer
+
+// creates the results file and the metadata of the run, and writes the metadata right away for ndjson results
+func openOutput() {
+	run.RunID = newRunID()
+	run.StartTime = time.Now().UTC()
+
+	// open the local csv file, which is independent of the output format
+	openCsvFile()
+
+	if outputFormat == "table" {
+		return
+	}
+
+	// open the results file, and move the results table out of the way if the results go to stdout
+	if outputFile == "" || outputFile == "-" {
+		output = bufio.NewWriter(os.Stdout)
+		console = os.Stderr
+	} else {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			panic("Failed to create the results file: " + err.Error())
+		}
+		output = bufio.NewWriter(f)
+		outputCloser = f
+	}
+
+	if outputFormat == "csv" {
+		addCsvWriter(output)
+	}
+
+}
+
+// records the metadata of a run with the current arguments, which is the whole benchmark or one scenario of a plan
+// file, and writes it right away for ndjson results
+func startRun(scenario string) {
+	// the scenarios of a plan file share the run id, so that their results can be told apart from other runs
+	run = runResults{
+		SchemaVersion: resultsSchemaVersion,
+		ToolVersion:   version,
+		RunID:         run.RunID,
+		StartTime:     run.StartTime,
+		Hostname:      hostname,
+		InstanceType:  instanceType,
+		Endpoint:      endpoint,
+		Region:        region,
+		Bucket:        bucketName,
+		Mode:          mode,
+		Scenario:      scenario,
+		LatencyTitles: latencyTitles(),
+		Percentiles:   percentiles,
+		Flags:         make(map[string]string),
+	}
+	if scenario != "" {
+		run.StartTime = time.Now().UTC()
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		run.Flags[f.Name] = f.Value.String()
+	})
+
+	// the seed is recorded even if it came from the clock, so that the run can be repeated
+	run.Flags["seed"] = strconv.FormatInt(randomSeed, 10)
+
+	if output != nil && outputFormat == "ndjson" {
+		header := run
+		header.Type = "run"
+		writeJSONLine(header)
+	}
+}
+
+// keeps the results of a finished scenario of a plan file for json results
+func finishRun() {
+	planRuns = append(planRuns, run)
+}
+
+// adds the results of one benchmark record to the structured results and the csv results, and returns the csv records
+// with the rows of the results appended
+func recordResult(r result, csvRecords [][]string) [][]string {
+	r.Time = time.Now().UTC()
+	r.Scenario = run.Scenario
+	if r.Operation == "" {
+		r.Operation = mode
+	}
+	if c, ok := calibrations[r.ObjectSize]; ok {
+		r.CeilingRequestRate, r.CeilingThroughput = c.requestRate, c.throughput
+	}
+
+	rows := csvRows(r)
+	writeCsvRows(rows)
+	observeResult(r)
+
+	switch outputFormat {
+	case "ndjson":
+		// every result is written right away, so that long running benchmarks can be followed
+		r.Type = "result"
+		writeJSONLine(r)
+	case "json":
+		run.Results = append(run.Results, r)
+	}
+
+	return append(csvRecords, rows...)
+}
+
+// writes the json results, and closes the results file
+func closeOutput() {
+	closeCsvFile()
+
+	if output == nil {
+		return
+	}
+
+	if outputFormat == "json" {
+		// the results of a plan file are one document with the runs of all its scenarios
+		document := run
+		if len(planRuns) > 0 {
+			document = runResults{
+				SchemaVersion: resultsSchemaVersion,
+				ToolVersion:   version,
+				RunID:         run.RunID,
+				StartTime:     planRuns[0].StartTime,
+				Hostname:      hostname,
+				InstanceType:  instanceType,
+				Scenarios:     planRuns,
+			}
+		}
+
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(document); err != nil {
+			panic("Failed to write the results: " + err.Error())
+		}
+	}
+
+	if err := output.Flush(); err != nil {
+		panic("Failed to write the results: " + err.Error())
+	}
+	if outputCloser != nil {
+		_ = outputCloser.Close()
+		fmt.Fprintf(console, "Results written to \033[1;33m%s\033[0m\n", outputFile)
+	}
+}
+
+// writes a value as one line of json, and flushes it so that it can be read while the benchmark is running
+func writeJSONLine(v interface{}) {
+	if err := json.NewEncoder(output).Encode(v); err != nil {
+		panic("Failed to write the results: " + err.Error())
+	}
+	if err := output.Flush(); err != nil {
+		panic("Failed to write the results: " + err.Error())
+	}
+}
+
+// returns the titles of the two latency columns of the results table of the benchmark mode
+func latencyTitles() []string {
+	return []string{benchmarkModes[mode].firstByteTitle, benchmarkModes[mode].lastByteTitle}
+}
+
+// returns an id that identifies the benchmark run, made of the start time and some random bytes
+func newRunID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102T150405Z"), b)
+}
+
+// converts the summary statistics to the format of the json and ndjson results
+func (s summary) stats() latencyStats {
+	stats := latencyStats{
+		Count:       s.count,
+		Avg:         s.avg,
+		Stddev:      s.stddev,
+		Min:         s.min,
+		Max:         s.max,
+		Percentiles: make(map[string]float64),
+	}
+	for i, q := range percentiles {
+		stats.Percentiles[percentileLabel(q)] = s.percentiles[i]
+	}
+	return stats
+}
+
+// converts the records of the operations of the mixed benchmark to the format of the json and ndjson results
+func operationResults(records map[string]*operationRecord, totalTime time.Duration) map[string]operationResult {
+	if len(records) == 0 {
+		return nil
+	}
+
+	results := make(map[string]operationResult)
+	for operation, record := range records {
+		results[operation] = operationResult{
+			Samples:     int(record.firstByte.count),
+			RequestRate: float64(record.firstByte.count) / totalTime.Seconds(),
+			FirstByte:   record.firstByte.summary().stats(),
+			LastByte:    record.lastByte.summary().stats(),
+		}
+	}
+	return results
+}
+
+// returns the results of one benchmark record, followed by the results of every operation of the mixed benchmark as
+// records of their own
+func withOperations(r result) []result {
+	results := []result{r}
+
+	for _, operation := range mixedOperations {
+		o, ok := r.Operations[operation]
+		if !ok {
+			continue
+		}
+
+		// only some of the operations transfer the payload
+		transferred := uint64(0)
+		if transfersPayload(operation) {
+			transferred = r.ObjectSize * uint64(o.Samples)
+		}
+
+		results = append(results, result{
+			Time:        r.Time,
+			Scenario:    r.Scenario,
+			Operation:   operation,
+			ObjectSize:  r.ObjectSize,
+			Threads:     r.Threads,
+			Run:         r.Run,
+			Samples:     o.Samples,
+			Bytes:       transferred,
+			Seconds:     r.Seconds,
+			Throughput:  float64(transferred) / r.Seconds / 1024 / 1024,
+			RequestRate: o.RequestRate,
+			FirstByte:   o.FirstByte,
+			LastByte:    o.LastByte,
+		})
+	}
+
+	return results
+}
+
+// converts the phases of the HTTP requests to the format of the json and ndjson results, along with the share of
+// requests that reused a connection
+func (r *phasesRecord) results() (map[string]latencyStats, float64) {
+	phases := make(map[string]latencyStats)
+	for _, name := range httpPhaseNames {
+		if h := r.phases[name]; h != nil && h.count > 0 {
+			phases[name] = h.summary().stats()
+		}
+	}
+	return phases, float64(r.reused) / float64(r.requests)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+// a benchmark plan, which is a list of scenarios that are run one after the other, read from a JSON file
+//
+//	{
+//	  "flags": {"bucket-name": "my-benchmarks", "region": "us-east-1", "profile": "benchmarks"},
+//	  "scenarios": [
+//	    {"name": "small-gets", "flags": {"mode": "get", "payloads-max": 4, "threads-min": 1, "threads-max": 32, "duration": "30s"}},
+//	    {"name": "large-puts", "flags": {"mode": "put", "payloads-min": 14, "payloads-max": 16, "key-prefix": "bench/"}}
+//	  ]
+//	}
+type plan struct {
+	// the arguments shared by all the scenarios, by flag name
+	Flags map[string]interface{} `json:"flags"`
+
+	Scenarios []planScenario `json:"scenarios"`
+}
+
+// a scenario of a benchmark plan, which is one benchmark run
+type planScenario struct {
+	Name string `json:"name"`
+
+	// the arguments of this scenario, by flag name, which override the shared arguments of the plan
+	Flags map[string]interface{} `json:"flags"`
+}
+
+// the plan file argument
+var planFile string
+
+// the arguments that apply to the whole plan, since the results and metrics go to one place, so they can't be set by
+// a scenario
+var planOnlyFlags = []string{"plan", "cleanup", "output", "output-file", "csv", "upload-csv", "metrics-address"}
+
+// runs every scenario of the plan file, with the arguments of the command line, then those of the plan, and then those
+// of the scenario
+func runPlan() {
+	p := loadPlan(planFile)
+
+	// the arguments of the command line, without the plan itself
+	var commandLine []string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "plan" {
+			commandLine = append(commandLine, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+
+	// every scenario starts over from the defaults of the arguments, with those of the command line, then those of the
+	// plan, and then its own
+	startScenario := func(i int, scenario planScenario) {
+		fmt.Fprintf(console, "\n=== \033[1;32mSCENARIO %d/%d\033[0m %s\n", i+1, len(p.Scenarios), scenario.Name)
+
+		parseFlags(append(append(append([]string{}, commandLine...), planArgs(p.Flags)...), planArgs(scenario.Flags)...))
+		setupS3Client()
+	}
+
+	// with the cleanup argument, only the objects uploaded by every scenario are deleted
+	if cleanupOnly {
+		for i, scenario := range p.Scenarios {
+			startScenario(i, scenario)
+			cleanup()
+		}
+		return
+	}
+
+	// the results and metrics are shared by all the scenarios, and set up with the arguments of the plan
+	parseFlags(append(append([]string{}, commandLine...), planArgs(p.Flags)...))
+	openOutput()
+	startMetricsServer()
+
+	for i, scenario := range p.Scenarios {
+		startScenario(i, scenario)
+
+		startRun(scenario.Name)
+		runCalibration()
+		setup()
+
+		if sweep := benchmarkModes[mode].sweep; sweep != nil {
+			sweep()
+		} else if saturationSearch {
+			runSaturationBenchmark()
+		} else {
+			runBenchmark()
+		}
+
+		cleanup()
+		finishRun()
+	}
+
+	closeOutput()
+}
+
+// reads and checks the plan file, so that mistakes show up before the first scenario runs
+func loadPlan(path string) plan {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic("Failed to read the plan file: " + err.Error())
+	}
+
+	// keep the numbers as they are written, so that integer arguments stay integers
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+
+	var p plan
+	if err := decoder.Decode(&p); err != nil {
+		panic("Failed to parse the plan file: " + err.Error())
+	}
+
+	if len(p.Scenarios) == 0 {
+		panic("The plan file has no scenarios")
+	}
+
+	names := make(map[string]bool)
+	for i, scenario := range p.Scenarios {
+		if scenario.Name == "" {
+			panic(fmt.Sprintf("Scenario %d of the plan file has no name", i+1))
+		}
+		if names[scenario.Name] {
+			panic("The plan file has more than one scenario named " + scenario.Name)
+		}
+		names[scenario.Name] = true
+
+		for name := range scenario.Flags {
+			checkPlanFlag(name)
+			for _, planOnly := range planOnlyFlags {
+				if name == planOnly {
+					panic("The " + name + " argument applies to the whole plan, so scenario " + scenario.Name + " can't set it")
+				}
+			}
+		}
+	}
+	for name := range p.Flags {
+		checkPlanFlag(name)
+		if name == "plan" || name == "cleanup" {
+			panic("The plan file can't set the " + name + " argument")
+		}
+	}
+
+	return p
+}
+
+// panics if the plan file has an argument that doesn't exist
+func checkPlanFlag(name string) {
+	if flag.Lookup(name) == nil {
+		panic("The plan file has an unknown argument: " + name)
+	}
+}
+
+// converts the arguments of a plan or scenario to command line arguments, in a stable order
+func planArgs(flags map[string]interface{}) []string {
+	var names []string
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		args = append(args, fmt.Sprintf("-%s=%v", name, flags[name]))
+	}
+	return args
+}
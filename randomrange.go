@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// uploads the large object read by the random range benchmark
+func setupRandomRange() {
+	fmt.Fprintf(console, "Uploading a \033[1;33m%-s\033[0m object\n", byteFormat(float64(rangeObjectSize)))
+
+	setupRequest(func() error { return uploadTestObject(generateS3Key(hostname, 1, rangeObjectSize), rangeObjectSize) })
+
+	fmt.Fprint(console, "\n")
+
+	// if the object couldn't be uploaded, all the requests that read it fail
+	printSetupFailures("upload")
+}
+
+// downloads a range of the given size at a random offset of the large object, and measures the first byte and last
+// byte latencies and the bytes of the range
+func getRandomRange(threadIndex int, rangeSize uint64) (latency, error) {
+	// ranges can't be larger than the object itself
+	if rangeSize > rangeObjectSize {
+		rangeSize = rangeObjectSize
+	}
+
+	// pick a random offset at which the whole range fits into the object
+	offset := uint64(rand.Int63n(int64(rangeObjectSize-rangeSize) + 1))
+
+	result, err := getObjectRange(generateS3Key(hostname, 1, rangeObjectSize), offset, rangeSize)
+	result.Bytes = rangeSize
+	return result, err
+}
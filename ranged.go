@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// runs the parallel ranged download benchmark for every object size, range size and range thread count
+func runRangedBenchmark() {
+	runPartsBenchmark("Ranged download", "Range Time to First Byte (ms)", "Object Time to Last Byte (ms)", execRangedTest)
+}
+
+// downloads objects of the given size as byte ranges fetched in parallel, one object at a time, and prints the results
+func execRangedTest(objectSize uint64, rangeSize uint64, rangeThreads int, csvRecords [][]string) [][]string {
+	// this overrides the sample count on small hosts that can get overwhelmed by a large throughput
+	samples := getTargetSampleCount(rangeThreads, samples)
+
+	// generate an S3 key from the sha hash of the hostname, thread index, and object size
+	key := generateS3Key(hostname, 1, objectSize)
+
+	var rangeLatencies, objectLatencies histogram
+
+	// the objects that failed to download, which don't count as samples
+	var failures errorCounts
+
+	// start the timer for this benchmark, and count the allocations of the client
+	allocs := startAllocStats()
+	resources := startTelemetry()
+	benchmarkTimer := time.Now()
+
+	objects := 0
+	for n := 0; !benchmarkConfig().testDone(n, samples, objectSize, benchmarkTimer); n++ {
+		// start the timer to measure the latency of the whole object
+		objectTimer := time.Now()
+
+		ranges := downloadRangedObject(key, objectSize, rangeSize, rangeThreads)
+		for _, r := range ranges {
+			if r.Failure != nil {
+				observeError(mode, objectSize, rangeThreads)
+				continue
+			}
+			rangeLatencies.record(r.FirstByte)
+			observeRequest(mode, objectSize, rangeThreads, r)
+		}
+		objectLatency := time.Now().Sub(objectTimer)
+
+		// the download fails if any of its ranges failed
+		failure, retried := partsFailure(ranges)
+		failures.record(latency{Failure: failure, Retries: retried})
+		if failure == nil {
+			objectLatencies.record(objectLatency)
+			objects++
+		}
+	}
+
+	// stop the timer for this benchmark
+	totalTime := time.Now().Sub(benchmarkTimer)
+	allocs.stop()
+	resources.stop()
+
+	// there are no latencies to summarize if every download failed, which only stops the benchmark with fail-fast
+	failures.checkSamples(objects)
+
+	return printPartsResult(objectSize, rangeSize, rangeThreads, objects, totalTime, rangeLatencies.summary(), objectLatencies.summary(), failures, allocs, resources, csvRecords)
+}
+
+// downloads the object in ranges of the given size, with the given number of ranges fetched in parallel, and returns
+// the first byte and last byte latencies of every range, or its error and retries
+func downloadRangedObject(key string, objectSize uint64, rangeSize uint64, rangeThreads int) []latency {
+	count := partCount(objectSize, rangeSize)
+
+	// a channel to submit the range indexes to download
+	ranges := make(chan int, count)
+	for n := 0; n < count; n++ {
+		ranges <- n
+	}
+	close(ranges)
+
+	// the results of every range, indexed by range index
+	latencies := make([]latency, count)
+
+	// download the ranges in parallel
+	var wg sync.WaitGroup
+	for w := 1; w <= rangeThreads && w <= count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range ranges {
+				// the byte range of the object for this request, inclusive of the last byte
+				start := uint64(n) * rangeSize
+				end := start + rangeSize
+				if end > objectSize {
+					end = objectSize
+				}
+
+				failure, retried := tryRequest(func() (err error) {
+					latencies[n], err = getObjectRange(key, start, end-start)
+					return err
+				})
+				latencies[n].Failure, latencies[n].Retries = failure, retried
+			}
+		}()
+	}
+	wg.Wait()
+
+	return latencies
+}
+
+// downloads the given byte range of the object, and measures the first byte and last byte latencies
+func getObjectRange(key string, offset uint64, length uint64) (latency, error) {
+	// start the timer to measure the first byte and last byte latencies
+	latencyTimer := time.Now()
+
+	// do the GetObject request for the range, where the end of the range is inclusive
+	ctx, trace := traceRequest()
+	body, err := store.GetObject(ctx, bucketName, key, fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	// if a request fails, fail the sample
+	if err != nil {
+		return latency{}, failRequest("Failed to get object range", err)
+	}
+
+	// measure the first byte latency
+	firstByte := time.Now().Sub(latencyTimer)
+
+	// read the whole range
+	if err := readBody(body, length); err != nil {
+		return latency{}, err
+	}
+
+	// measure the last byte latency
+	lastByte := time.Now().Sub(latencyTimer)
+
+	return trace.finish(latency{FirstByte: firstByte, LastByte: lastByte}, latencyTimer), nil
+}
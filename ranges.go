@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// the units of the sizes argument, where the binary units are powers of 1024 and the decimal units are powers of 1000
+var sizeUnits = map[string]uint64{
+	"":    1,
+	"B":   1,
+	"KB":  1000,
+	"MB":  1000 * 1000,
+	"GB":  1000 * 1000 * 1000,
+	"TB":  1000 * 1000 * 1000 * 1000,
+	"KIB": 1024,
+	"MIB": 1024 * 1024,
+	"GIB": 1024 * 1024 * 1024,
+	"TIB": 1024 * 1024 * 1024 * 1024,
+}
+
+// returns the power of two object sizes of the payloads arguments, where 1 = 1 KB
+func powerOfTwoSizes(min int, max int) []uint64 {
+	var sizes []uint64
+	for p := min; p <= max; p++ {
+		sizes = append(sizes, uint64(1024)<<uint(p-1))
+	}
+	return sizes
+}
+
+// parses the comma separated object sizes of the sizes argument, e.g. "4KiB,100KB,1MiB..64MiB*2,10MB..50MB+10MB"
+func parseSizes(list string) []uint64 {
+	return parseRanges(list, parseSize, 0, "size")
+}
+
+// parses the comma separated thread counts of the threads argument, e.g. "1,2,4,8..64*2,100..500+100"
+func parseThreadCounts(list string) []int {
+	var counts []int
+	for _, count := range parseRanges(list, parseCount, 1, "thread count") {
+		counts = append(counts, int(count))
+	}
+	return counts
+}
+
+// parses a comma separated list of values and ranges of values, where a range either multiplies its start by a factor
+// or adds a step to it until it reaches its end, and a value is never repeated, and every value is at least the minimum
+func parseRanges(list string, parseValue func(string) uint64, min uint64, name string) []uint64 {
+	var values []uint64
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(part, "..", 2)
+		if len(bounds) == 1 {
+			value := parseValue(part)
+			if value < min {
+				panic(fmt.Sprintf("The %ss must be at least %d: %s", name, min, part))
+			}
+			values = appendValue(values, value)
+			continue
+		}
+
+		// the end of the range is followed by its step, which is a factor or a value
+		i := strings.IndexAny(bounds[1], "*+")
+		if i <= 0 {
+			panic("The " + name + " range needs a factor (e.g. 1..64*2) or a step (e.g. 10..100+10): " + part)
+		}
+
+		start := parseValue(bounds[0])
+		end := parseValue(bounds[1][:i])
+		step := bounds[1][i+1:]
+		if start > end {
+			panic("The start of the " + name + " range is larger than its end: " + part)
+		}
+		if start < min {
+			panic(fmt.Sprintf("The start of the %s range must be at least %d: %s", name, min, part))
+		}
+
+		if bounds[1][i] == '*' {
+			// a geometric range
+			factor, err := strconv.ParseFloat(strings.TrimSpace(step), 64)
+			if err != nil || !(factor > 1) || math.IsInf(factor, 1) {
+				panic("Invalid factor of the " + name + " range, it must be greater than 1: " + part)
+			}
+
+			// a start of 0 would stay 0 however often it is multiplied
+			if start == 0 {
+				panic("The start of the " + name + " range must be greater than 0 to multiply it: " + part)
+			}
+			for value := float64(start); uint64(math.Round(value)) <= end; value *= factor {
+				values = appendValue(values, uint64(math.Round(value)))
+			}
+		} else {
+			// a linear range
+			increment := parseValue(step)
+			if increment == 0 {
+				panic("Invalid step of the " + name + " range, it must be greater than 0: " + part)
+			}
+			for value := start; value <= end; value += increment {
+				values = appendValue(values, value)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		panic("There are no " + name + "s in: " + list)
+	}
+	return values
+}
+
+// parses a whole number, e.g. a thread count
+func parseCount(text string) uint64 {
+	count, err := strconv.ParseUint(strings.TrimSpace(text), 10, 64)
+	if err != nil {
+		panic("Invalid number: " + text)
+	}
+	return count
+}
+
+// parses a size with an optional unit, e.g. "100KB" or "1.5GiB"
+func parseSize(text string) uint64 {
+	text = strings.TrimSpace(text)
+
+	// split the number from the unit
+	i := strings.IndexFunc(text, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(text)
+	}
+
+	number, err := strconv.ParseFloat(text[:i], 64)
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(text[i:]))]
+	if err != nil || !ok {
+		panic("Invalid size, it must be a number with an optional unit like KB, KiB, MB, MiB, GB or GiB: " + text)
+	}
+
+	return uint64(math.Round(number * float64(unit)))
+}
+
+// adds a value to the values unless it is already in them, so that overlapping ranges don't test a value twice
+func appendValue(values []uint64, value uint64) []uint64 {
+	if containsValue(values, value) {
+		return values
+	}
+	return append(values, value)
+}
+
+// whether the values contain the given value
+func containsValue(values []uint64, value uint64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
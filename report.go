@@ -0,0 +1,475 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the colors of the lines of the charts, which repeat if there are more lines
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// the size of the charts and of the margins around their plot area, in pixels
+const chartWidth = 640
+const chartHeight = 360
+const chartMarginLeft = 64
+const chartMarginRight = 20
+const chartMarginTop = 20
+const chartMarginBottom = 48
+
+// a line of a chart, with its points sorted by x
+type chartSeries struct {
+	name   string
+	points []chartPoint
+}
+
+// a point of a line of a chart
+type chartPoint struct {
+	x float64
+	y float64
+}
+
+// a chart of the report, which is rendered as inline svg with a legend
+type reportChart struct {
+	Title  string
+	SVG    template.HTML
+	Legend []reportLegend
+}
+
+// an entry of the legend of a chart
+type reportLegend struct {
+	Name  string
+	Color string
+}
+
+// the charts of the latencies of one object size
+type reportLatencies struct {
+	Title     string
+	FirstByte reportChart
+	LastByte  reportChart
+}
+
+// everything on the report page
+type reportPage struct {
+	Run         runResults
+	Metadata    [][2]string
+	Throughput  reportChart
+	Latencies   []reportLatencies
+	Columns     []string
+	Rows        [][]string
+	GeneratedBy string
+}
+
+// the template of the report page, which has no scripts and no external resources so that it works offline
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>S3 benchmark report {{.Run.RunID}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; margin-top: 2em; border-bottom: 1px solid #ddd; }
+h3 { font-size: 1.1em; }
+table { border-collapse: collapse; font-size: 0.85em; }
+th, td { border: 1px solid #ddd; padding: 0.25em 0.6em; text-align: right; }
+th { background: #f4f4f4; }
+td.text, th.text { text-align: left; }
+.charts { display: flex; flex-wrap: wrap; gap: 2em; }
+.chart { display: inline-block; }
+.legend span { display: inline-block; margin-right: 1em; font-size: 0.85em; }
+.legend i { display: inline-block; width: 1.2em; height: 0.3em; margin-right: 0.3em; vertical-align: middle; }
+svg text { font-size: 11px; fill: #444; }
+</style>
+</head>
+<body>
+<h1>S3 benchmark report</h1>
+
+<h2>Run</h2>
+<table>
+{{range .Metadata}}<tr><th class="text">{{index . 0}}</th><td class="text">{{index . 1}}</td></tr>
+{{end}}</table>
+
+<h2>Throughput</h2>
+{{template "chart" .Throughput}}
+
+<h2>Latencies</h2>
+{{range .Latencies}}<h3>{{.Title}}</h3>
+<div class="charts">
+{{template "chart" .FirstByte}}
+{{template "chart" .LastByte}}
+</div>
+{{end}}
+
+<h2>Results</h2>
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+
+<p><small>{{.GeneratedBy}}</small></p>
+</body>
+</html>
+{{define "chart"}}<div class="chart">
+<h4>{{.Title}}</h4>
+{{.SVG}}
+<div class="legend">{{range .Legend}}<span><i style="background: {{.Color}}"></i>{{.Name}}</span>{{end}}</div>
+</div>{{end}}
+`))
+
+// turns a results file of this tool into a single html file with charts, which needs no network access to view
+func runReport(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	outputArg := flags.String("o", "", "The html file to write, which defaults to the results file with an .html extension.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: s3-benchmark report [options] <results>")
+		fmt.Fprintln(flags.Output(), "Turns a JSON, NDJSON or CSV results file of this tool into a self-contained HTML report.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path := flags.Arg(0)
+	target := *outputArg
+	if target == "" {
+		target = strings.TrimSuffix(path, filepath.Ext(path)) + ".html"
+	}
+
+	run := loadResults(path)
+	if len(run.Results) == 0 {
+		panic("The results file " + path + " has no results")
+	}
+
+	f, err := os.Create(target)
+	if err != nil {
+		panic("Failed to create the report: " + err.Error())
+	}
+
+	if err := reportTemplate.Execute(f, buildReport(run)); err != nil {
+		panic("Failed to write the report: " + err.Error())
+	}
+	_ = f.Close()
+
+	fmt.Printf("Report written to \033[1;33m%s\033[0m\n", target)
+	return 0
+}
+
+// builds the charts and tables of the report
+func buildReport(run runResults) reportPage {
+	page := reportPage{
+		Run:         run,
+		GeneratedBy: "Generated by s3-benchmark " + version,
+	}
+
+	startTime := ""
+	if !run.StartTime.IsZero() {
+		startTime = run.StartTime.Format("2006-01-02 15:04:05 MST")
+	}
+
+	// the metadata that is missing from csv results is left out
+	for _, m := range [][2]string{
+		{"Run id", run.RunID},
+		{"Start time", startTime},
+		{"Mode", run.Mode},
+		{"Hostname", run.Hostname},
+		{"Instance type", run.InstanceType},
+		{"Endpoint", run.Endpoint},
+		{"Region", run.Region},
+		{"Bucket", run.Bucket},
+		{"Tool version", run.ToolVersion},
+	} {
+		if m[1] != "" {
+			page.Metadata = append(page.Metadata, m)
+		}
+	}
+	var flagNames []string
+	for name := range run.Flags {
+		flagNames = append(flagNames, name)
+	}
+	sort.Strings(flagNames)
+	for _, name := range flagNames {
+		page.Metadata = append(page.Metadata, [2]string{"-" + name, run.Flags[name]})
+	}
+
+	// the results of the benchmark mode, without the rows of every operation of the mixed benchmark in csv results
+	var results []result
+	for _, r := range run.Results {
+		if run.Mode == "" || r.Operation == run.Mode || r.Operation == "" {
+			results = append(results, r)
+		}
+	}
+
+	xLabel := "Threads"
+	for _, r := range results {
+		if r.Run > 0 {
+			xLabel = "Run"
+			break
+		}
+		if r.PartThreads > 0 {
+			xLabel = "Part threads"
+		}
+	}
+	x := func(r result) float64 {
+		switch xLabel {
+		case "Run":
+			return float64(r.Run)
+		case "Part threads":
+			return float64(r.PartThreads)
+		}
+		return float64(r.Threads)
+	}
+
+	// the throughput is in requests per second for the benchmarks that don't transfer payloads, which depends on the
+	// mode of the results and not on their bytes, since a test in which all the requests failed has none
+	unit := "MB/s"
+	for _, r := range results {
+		operation := r.Operation
+		if operation == "" {
+			operation = run.Mode
+		}
+		if benchmarkModes[operation].countsRequests {
+			unit = "op/s"
+		}
+	}
+
+	// group the results into one line per object size and part size
+	groups := make(map[string][]result)
+	var names []string
+	for _, r := range results {
+		name := byteFormat(float64(r.ObjectSize))
+		if r.Scenario != "" {
+			name = r.Scenario + ": " + name
+		}
+		if r.PartSize > 0 {
+			name += " in " + byteFormat(float64(r.PartSize)) + " parts"
+		}
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], r)
+	}
+
+	latencyTitles := run.LatencyTitles
+	if len(latencyTitles) != 2 {
+		latencyTitles = []string{"Time to First Byte (ms)", "Time to Last Byte (ms)"}
+	}
+	labels := reportPercentiles(run)
+
+	var throughput []chartSeries
+	for _, name := range names {
+		throughput = append(throughput, chartLine(name, groups[name], x, func(r result) float64 {
+			if unit == "op/s" {
+				return r.RequestRate
+			}
+			return r.Throughput
+		}))
+
+		latencies := reportLatencies{Title: name}
+		for i, stats := range []func(result) latencyStats{
+			func(r result) latencyStats { return r.FirstByte },
+			func(r result) latencyStats { return r.LastByte },
+		} {
+			stats := stats
+			lines := []chartSeries{chartLine("avg", groups[name], x, func(r result) float64 { return stats(r).Avg })}
+			for _, label := range labels {
+				label := label
+				lines = append(lines, chartLine(label, groups[name], x, func(r result) float64 { return stats(r).Percentiles[label] }))
+			}
+			chart := newChart(latencyTitles[i], xLabel, "ms", lines)
+			if i == 0 {
+				latencies.FirstByte = chart
+			} else {
+				latencies.LastByte = chart
+			}
+		}
+		page.Latencies = append(page.Latencies, latencies)
+	}
+	page.Throughput = newChart("Throughput ("+unit+")", xLabel, unit, throughput)
+
+	// the table of all the results, including the operations of the mixed benchmark
+	page.Columns = []string{"Operation", "Object Size", "Part Size", "Threads", "Part Threads", "Run", "Samples", "MB/s", "op/s", "Errors %"}
+	for _, prefix := range []string{"TTFB", "TTLB"} {
+		page.Columns = append(page.Columns, prefix+" avg")
+		for _, label := range labels {
+			page.Columns = append(page.Columns, prefix+" "+label)
+		}
+	}
+	for _, r := range run.Results {
+		for _, o := range withOperations(r) {
+			operation := o.Operation
+			if o.Scenario != "" {
+				operation = o.Scenario + "/" + o.Operation
+			}
+
+			row := []string{
+				operation,
+				byteFormat(float64(o.ObjectSize)),
+				byteFormat(float64(o.PartSize)),
+				strconv.Itoa(o.Threads),
+				strconv.Itoa(o.PartThreads),
+				strconv.Itoa(o.Run),
+				strconv.Itoa(o.Samples),
+				fmt.Sprintf("%.1f", o.Throughput),
+				fmt.Sprintf("%.1f", o.RequestRate),
+				fmt.Sprintf("%.1f", o.ErrorPercent),
+			}
+			for _, stats := range []latencyStats{o.FirstByte, o.LastByte} {
+				row = append(row, fmt.Sprintf("%.1f", stats.Avg))
+				for _, label := range labels {
+					row = append(row, fmt.Sprintf("%.1f", stats.Percentiles[label]))
+				}
+			}
+			page.Rows = append(page.Rows, row)
+		}
+	}
+
+	return page
+}
+
+// returns the labels of the percentiles of the results, in increasing order
+func reportPercentiles(run runResults) []string {
+	var labels []string
+	if len(run.Percentiles) > 0 {
+		for _, q := range run.Percentiles {
+			labels = append(labels, percentileLabel(q))
+		}
+		return labels
+	}
+
+	// csv results only have the percentiles in their column names
+	for label := range run.Results[0].LastByte.Percentiles {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		a, _ := strconv.ParseFloat(strings.TrimPrefix(labels[i], "p"), 64)
+		b, _ := strconv.ParseFloat(strings.TrimPrefix(labels[j], "p"), 64)
+		return a < b
+	})
+	return labels
+}
+
+// returns a line of the values of the results, where the results with the same x are averaged
+func chartLine(name string, results []result, x func(result) float64, y func(result) float64) chartSeries {
+	sums := make(map[float64]float64)
+	counts := make(map[float64]int)
+	for _, r := range results {
+		sums[x(r)] += y(r)
+		counts[x(r)]++
+	}
+
+	series := chartSeries{name: name}
+	for px, sum := range sums {
+		series.points = append(series.points, chartPoint{x: px, y: sum / float64(counts[px])})
+	}
+	sort.Slice(series.points, func(i, j int) bool { return series.points[i].x < series.points[j].x })
+	return series
+}
+
+// renders a line chart as inline svg, with the y axis starting at zero
+func newChart(title string, xLabel string, yLabel string, lines []chartSeries) reportChart {
+	chart := reportChart{Title: title}
+
+	minX, maxX, maxY := math.Inf(1), math.Inf(-1), 0.0
+	xs := make(map[float64]bool)
+	for _, line := range lines {
+		for _, p := range line.points {
+			minX = math.Min(minX, p.x)
+			maxX = math.Max(maxX, p.x)
+			maxY = math.Max(maxY, p.y)
+			xs[p.x] = true
+		}
+	}
+	if len(xs) == 0 {
+		minX, maxX = 0, 1
+	}
+	if minX == maxX {
+		minX, maxX = minX-1, maxX+1
+	}
+
+	yStep := niceStep(maxY / 5)
+	maxY = math.Ceil(maxY/yStep) * yStep
+	if maxY == 0 {
+		maxY = yStep
+	}
+
+	plotWidth := float64(chartWidth - chartMarginLeft - chartMarginRight)
+	plotHeight := float64(chartHeight - chartMarginTop - chartMarginBottom)
+	px := func(x float64) float64 { return chartMarginLeft + (x-minX)/(maxX-minX)*plotWidth }
+	py := func(y float64) float64 { return chartMarginTop + plotHeight - y/maxY*plotHeight }
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, chartWidth, chartHeight, chartWidth, chartHeight)
+
+	// the horizontal grid lines and the labels of the y axis
+	for y := 0.0; y <= maxY+yStep/2; y += yStep {
+		fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#eee"/>`, px(minX), py(y), px(maxX), py(y))
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="end">%s</text>`, px(minX)-6, py(y)+4, strconv.FormatFloat(y, 'f', -1, 64))
+	}
+
+	// the labels of the x axis, which are the tested values unless there are too many of them
+	var ticks []float64
+	if len(xs) <= 12 {
+		for x := range xs {
+			ticks = append(ticks, x)
+		}
+	} else {
+		step := niceStep((maxX - minX) / 8)
+		for x := math.Ceil(minX/step) * step; x <= maxX; x += step {
+			ticks = append(ticks, x)
+		}
+	}
+	for _, x := range ticks {
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, px(x), py(0)+16, strconv.FormatFloat(x, 'f', -1, 64))
+	}
+
+	// the axes and their titles
+	fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#888"/>`, px(minX), py(0), px(maxX), py(0))
+	fmt.Fprintf(&svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#888"/>`, px(minX), py(0), px(minX), py(maxY))
+	fmt.Fprintf(&svg, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, px((minX+maxX)/2), chartHeight-8, html.EscapeString(xLabel))
+	fmt.Fprintf(&svg, `<text x="14" y="%.1f" text-anchor="middle" transform="rotate(-90 14 %.1f)">%s</text>`, py(maxY/2), py(maxY/2), html.EscapeString(yLabel))
+
+	// the lines, with a tooltip on every point
+	for i, line := range lines {
+		color := chartColors[i%len(chartColors)]
+		var points []string
+		for _, p := range line.points {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", px(p.x), py(p.y)))
+		}
+		fmt.Fprintf(&svg, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(points, " "))
+		for _, p := range line.points {
+			fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s: %s %s, %.1f %s</title></circle>`,
+				px(p.x), py(p.y), color, html.EscapeString(line.name), html.EscapeString(xLabel), strconv.FormatFloat(p.x, 'f', -1, 64), p.y, html.EscapeString(yLabel))
+		}
+		chart.Legend = append(chart.Legend, reportLegend{Name: line.name, Color: color})
+	}
+
+	svg.WriteString(`</svg>`)
+	chart.SVG = template.HTML(svg.String())
+	return chart
+}
+
+// returns a round step of at least the given size, which is 1, 2, 2.5 or 5 times a power of ten
+func niceStep(step float64) float64 {
+	if step <= 0 {
+		return 1
+	}
+
+	magnitude := math.Pow(10, math.Floor(math.Log10(step)))
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*magnitude >= step {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
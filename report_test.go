@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReportThroughputUnit(t *testing.T) {
+	latencies := latencyStats{Count: 10, Avg: 20, Percentiles: map[string]float64{"p50": 20}}
+	failed := latencyStats{Percentiles: map[string]float64{}}
+
+	// a test of a get benchmark in which all the requests failed has no bytes, but is still in MB/s
+	get := buildReport(runResults{Mode: "get", Percentiles: []float64{50}, Results: []result{
+		{Operation: "get", ObjectSize: 1024, Threads: 1, Samples: 10, Bytes: 10240, Throughput: 5, RequestRate: 5000, LastByte: latencies},
+		{Operation: "get", ObjectSize: 1024, Threads: 2, Bytes: 0, Errors: 10, ErrorPercent: 100, LastByte: failed},
+	}})
+	if get.Throughput.Title != "Throughput (MB/s)" {
+		t.Fatalf("Expected the throughput in MB/s, got %s", get.Throughput.Title)
+	}
+
+	head := buildReport(runResults{Mode: "head", Percentiles: []float64{50}, Results: []result{
+		{Operation: "head", ObjectSize: 1024, Threads: 1, Samples: 10, RequestRate: 5000, LastByte: latencies},
+	}})
+	if head.Throughput.Title != "Throughput (op/s)" {
+		t.Fatalf("Expected the throughput in op/s, got %s", head.Throughput.Title)
+	}
+}
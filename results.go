@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loads a results file of this tool, which is either json, ndjson or csv
+func loadResults(path string) runResults {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic("Failed to read the results file: " + err.Error())
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		return parseJSONResults(content)
+	}
+	return parseCsvResults(content)
+}
+
+// parses json results, which are either a whole document or ndjson with a run line followed by result lines
+func parseJSONResults(content []byte) runResults {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+
+	var first json.RawMessage
+	if err := decoder.Decode(&first); err != nil {
+		panic("Failed to parse the json results: " + err.Error())
+	}
+
+	var header runResults
+	if err := json.Unmarshal(first, &header); err != nil {
+		panic("Failed to parse the json results: " + err.Error())
+	}
+	if header.SchemaVersion > resultsSchemaVersion {
+		panic(fmt.Sprintf("The results have schema version %d, but this version of the tool only reads up to %d", header.SchemaVersion, resultsSchemaVersion))
+	}
+
+	// a whole document has all the results in it, which are in the runs of the scenarios for a plan file
+	if header.Type != "run" {
+		for i, scenario := range header.Scenarios {
+			if i == 0 {
+				header.Mode = scenario.Mode
+				header.LatencyTitles = scenario.LatencyTitles
+				header.Percentiles = scenario.Percentiles
+			}
+			if scenario.Mode != header.Mode {
+				header.Mode = ""
+			}
+			header.Results = append(header.Results, scenario.Results...)
+		}
+		return header
+	}
+
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic("Failed to parse the ndjson results: " + err.Error())
+		}
+
+		var r result
+		if err := json.Unmarshal(raw, &r); err != nil {
+			panic("Failed to parse the ndjson results: " + err.Error())
+		}
+
+		switch r.Type {
+		case "result":
+			header.Results = append(header.Results, r)
+		case "run":
+			// the scenarios of a plan file each start with a run line, and may be of different modes
+			var scenario runResults
+			if err := json.Unmarshal(raw, &scenario); err == nil && scenario.Mode != header.Mode {
+				header.Mode = ""
+			}
+		}
+	}
+	return header
+}
+
+// parses csv results with a header row, which only have the run metadata that is in the columns of every row
+func parseCsvResults(content []byte) runResults {
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil || len(rows) == 0 {
+		panic("Failed to parse the csv results, which need a header row")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	if _, ok := columns["operation"]; !ok {
+		panic("Failed to parse the csv results, which need a header row")
+	}
+
+	var run runResults
+	for _, row := range rows[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		number := func(name string) float64 {
+			v, _ := strconv.ParseFloat(field(name), 64)
+			return v
+		}
+		stats := func(prefix string) latencyStats {
+			s := latencyStats{
+				Avg:         number(prefix + "_avg_ms"),
+				Stddev:      number(prefix + "_std_ms"),
+				Min:         number(prefix + "_min_ms"),
+				Max:         number(prefix + "_max_ms"),
+				Percentiles: make(map[string]float64),
+			}
+			for name := range columns {
+				if strings.HasPrefix(name, prefix+"_p") && strings.HasSuffix(name, "_ms") {
+					s.Percentiles[strings.TrimSuffix(strings.TrimPrefix(name, prefix+"_"), "_ms")] = number(name)
+				}
+			}
+			return s
+		}
+
+		if run.RunID == "" {
+			run.RunID = field("run_id")
+			run.Hostname = field("hostname")
+			run.InstanceType = field("instance_type")
+			run.Mode = field("mode")
+		}
+
+		// the scenarios of a plan file may be of different modes
+		if field("mode") != run.Mode {
+			run.Mode = ""
+		}
+
+		timestamp, _ := time.Parse(time.RFC3339, field("timestamp"))
+		if run.StartTime.IsZero() {
+			run.StartTime = timestamp
+		}
+
+		// the error classes that occurred at all
+		var classes map[string]uint64
+		for name := range columns {
+			if strings.HasPrefix(name, "errors_") && number(name) > 0 {
+				if classes == nil {
+					classes = make(map[string]uint64)
+				}
+				classes[strings.TrimPrefix(name, "errors_")] = uint64(number(name))
+			}
+		}
+
+		run.Results = append(run.Results, result{
+			Time:         timestamp,
+			Scenario:     field("scenario"),
+			Operation:    field("operation"),
+			ObjectSize:   uint64(number("object_size")),
+			PartSize:     uint64(number("part_size")),
+			Threads:      int(number("threads")),
+			PartThreads:  int(number("part_threads")),
+			Run:          int(number("run")),
+			Samples:      int(number("samples")),
+			Bytes:        uint64(number("bytes")),
+			Seconds:      number("seconds"),
+			Throughput:   number("throughput_mb_per_second"),
+			RequestRate:  number("requests_per_second"),
+			ObjectRate:   number("objects_per_second"),
+			Errors:       uint64(number("errors")),
+			ErrorPercent: number("error_percent"),
+			ErrorClasses: classes,
+			Retries:      uint64(number("retries")),
+			FirstByte:    stats("first_byte"),
+			LastByte:     stats("last_byte"),
+
+			AllocBytesPerRequest: number("alloc_bytes_per_request"),
+			AllocsPerRequest:     number("allocs_per_request"),
+			GCCycles:             uint32(number("gc_cycles")),
+			GCPauseMs:            number("gc_pause_ms"),
+			GCPauseMaxMs:         number("gc_pause_max_ms"),
+
+			CPUPercent:    number("cpu_percent"),
+			CPUPercentMax: number("cpu_percent_max"),
+			RSSBytes:      uint64(number("rss_bytes")),
+			NICRxBytes:    uint64(number("nic_rx_bytes")),
+			NICTxBytes:    uint64(number("nic_tx_bytes")),
+			ClientBound:   field("client_bound"),
+
+			CeilingRequestRate: number("client_ceiling_requests_per_second"),
+			CeilingThroughput:  number("client_ceiling_mb_per_second"),
+		})
+	}
+	return run
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+)
+
+// whether to search for the saturation point of every object size instead of testing every thread count
+var saturationSearch bool
+
+// the throughput gain in percent below which more threads don't count as an improvement
+var saturationGain float64
+
+// the factor by which the tail latency may grow over the best thread count before the search stops adding threads
+var saturationLatency float64
+
+// the thread count found by the saturation search for an object size, where the throughput stops growing
+type saturationKnee struct {
+	payload uint64
+	threads int
+	rate    float64
+	tail    float64
+	tested  int
+}
+
+// runs the benchmark for every object size, testing only the thread counts needed to find the knee of the throughput
+// curve, by doubling the threads until the throughput stops growing and then bisecting between the last two
+func runSaturationBenchmark() {
+	fmt.Fprint(console, "\n--- \033[1;32mBENCHMARK\033[0m ----------------------------------------------------------------------------------------------------------------\n\n")
+
+	// array of csv records used to upload the results to S3 when the test is finished
+	var csvRecords [][]string
+
+	var knees []saturationKnee
+
+	// loop over every payload size
+	for _, payload := range payloadSizes {
+		// print the header for the benchmark of this object size
+		printHeader(payload)
+
+		var knee saturationKnee
+		knee, csvRecords = searchSaturation(payload, csvRecords)
+		threadsTable.printFooter()
+		printCalibration(payload)
+
+		fmt.Fprintf(console, "Saturation at \033[1;33m%d threads\033[0m with \033[1;31m%.1f %s\033[0m, after testing %d thread counts\n\n",
+			knee.threads, knee.rate, saturationUnit(), knee.tested)
+		knees = append(knees, knee)
+
+		// print the phases of the HTTP requests, if they were traced
+		printPhases()
+
+		// the payload size doesn't matter to some benchmarks, so they only need to run once
+		if benchmarkModes[mode].payloadless {
+			break
+		}
+	}
+
+	printSaturationSummary(knees)
+
+	// if the csv option is true, upload the csv results to S3
+	if csvResults != "" {
+		uploadCsvResults(csvRecords)
+	}
+}
+
+// searches for the knee of the throughput curve of an object size between the min and max threads
+func searchSaturation(payload uint64, csvRecords [][]string) (saturationKnee, [][]string) {
+	// the results of every thread count tested for this object size
+	tested := make(map[int]result)
+	test := func(threads int) result {
+		if r, ok := tested[threads]; ok {
+			return r
+		}
+		var r result
+		csvRecords, r = execTest(benchmarkConfig(), threads, payload, 1, csvRecords)
+		tested[threads] = r
+		return r
+	}
+
+	threads, best := bisectSaturation(test)
+	knee := saturationKnee{payload: payload, threads: threads, rate: saturationRate(best), tail: tailLatency(best), tested: len(tested)}
+	return knee, csvRecords
+}
+
+// returns the thread count of the knee and its results, by doubling the threads as long as that improves the
+// throughput enough without degrading the tail latency, and then bisecting between the last thread count that
+// improved the throughput and the first that didn't, where the test function may be called for the same thread count
+// more than once
+func bisectSaturation(test func(threads int) result) (int, result) {
+	low := threadsMin
+	if low < 1 {
+		low = 1
+	}
+	best := test(low)
+	high := 0
+	for t := low * 2; t <= threadsMax; t *= 2 {
+		if !saturationImproves(best, test(t)) {
+			high = t
+			break
+		}
+		low, best = t, test(t)
+	}
+
+	// the thread counts above the last doubling are tested too, up to the max argument
+	if high == 0 && low < threadsMax {
+		if saturationImproves(best, test(threadsMax)) {
+			low, best = threadsMax, test(threadsMax)
+		} else {
+			high = threadsMax
+		}
+	}
+
+	for high > 0 && high-low > 1 {
+		mid := (low + high) / 2
+		if saturationImproves(best, test(mid)) {
+			low, best = mid, test(mid)
+		} else {
+			high = mid
+		}
+	}
+	return low, best
+}
+
+// whether the candidate thread count improves the throughput over the best one by at least the gain argument, without
+// growing the tail latency by more than the latency argument
+func saturationImproves(best result, candidate result) bool {
+	if saturationRate(candidate) < saturationRate(best)*(1+saturationGain/100) {
+		return false
+	}
+	return tailLatency(best) == 0 || tailLatency(candidate) <= tailLatency(best)*saturationLatency
+}
+
+// returns the throughput of the results, in the unit of the benchmark mode
+func saturationRate(r result) float64 {
+	if benchmarkModes[mode].countsRequests {
+		return r.RequestRate
+	}
+	return r.Throughput
+}
+
+// returns the unit of the throughput of the benchmark mode
+func saturationUnit() string {
+	if benchmarkModes[mode].countsRequests {
+		return "op/s"
+	}
+	return "MB/s"
+}
+
+// returns the highest percentile of the last byte latencies, or the max if there are no percentiles
+func tailLatency(r result) float64 {
+	if len(percentiles) == 0 {
+		return r.LastByte.Max
+	}
+	return r.LastByte.Percentiles[percentileLabel(percentiles[len(percentiles)-1])]
+}
+
+// prints the thread count of the knee of every object size
+func printSaturationSummary(knees []saturationKnee) {
+	tail := "max"
+	if len(percentiles) > 0 {
+		tail = percentileLabel(percentiles[len(percentiles)-1])
+	}
+
+	fmt.Fprintln(console, "Saturation points")
+	fmt.Fprintln(console, "+-------------+---------+----------------+----------------+--------+")
+	fmt.Fprintf(console, "| Object Size | Threads |     Throughput | %-14s | Tested |\n", fmt.Sprintf("%s (ms)", tail))
+	fmt.Fprintln(console, "+-------------+---------+----------------+----------------+--------+")
+	for _, k := range knees {
+		fmt.Fprintf(console, "| %11s | %7d | %9.1f %s | %14.1f | %6d |\n", byteFormat(float64(k.payload)), k.threads, k.rate, saturationUnit(), k.tail, k.tested)
+	}
+	fmt.Fprint(console, "+-------------+---------+----------------+----------------+--------+\n\n")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSaturationSearch(t *testing.T) {
+	s, restore := useMemoryStore(t, "get")
+	defer restore()
+	payloadSizes = []uint64{256 * 1024}
+	threadsMin, threadsMax = 1, 16
+	samples = 20
+	setup()
+
+	// every request reads at 51.2 MB/s, and all of them together too, so only the time to first byte of a second
+	// thread overlaps with the transfer of the first, and the gain is high enough not to mistake the noise of a busy
+	// machine for an improvement
+	s.bandwidth = 51.2 * 1024 * 1024
+	s.shared = &bandwidthLimiter{bandwidth: s.bandwidth}
+	saturationGain, saturationLatency = 30, 10
+
+	// the knee is at 2 threads, but the timings of a busy machine can push it to the next doubling
+	knee, _ := searchSaturation(payloadSizes[0], nil)
+	if knee.threads < 2 || knee.threads > 4 || knee.tested > 6 {
+		t.Fatalf("Expected the knee between 2 and 4 threads after at most 6 thread counts, got %d threads after %d", knee.threads, knee.tested)
+	}
+}
+
+func TestBisectSaturation(t *testing.T) {
+	_, restore := useMemoryStore(t, "get")
+	defer restore()
+	saturationGain, saturationLatency = 5, 2
+
+	tests := []struct {
+		min, max int
+		curve    func(threads int) float64
+		expected int
+		tested   []int
+	}{
+		// the throughput collapses above 6 threads, so the search doubles up to 8 and bisects back to 6
+		{1, 64, func(threads int) float64 {
+			if threads > 6 {
+				return 4
+			}
+			return float64(threads)
+		}, 6, []int{1, 2, 4, 8, 6, 7}},
+
+		// the throughput stops growing at 5 threads, which the doubling to 8 still improves on
+		{1, 64, func(threads int) float64 { return math.Min(float64(threads), 5) }, 8, []int{1, 2, 4, 8, 16, 12, 10, 9}},
+
+		// a knee below the first doubling is found when the search starts at 1 thread
+		{1, 64, func(threads int) float64 { return 1 }, 1, []int{1, 2}},
+
+		// the max threads are tested even if they aren't a doubling of the min threads
+		{1, 12, func(threads int) float64 { return float64(threads) }, 12, []int{1, 2, 4, 8, 12}},
+
+		// the search starts at the min threads, and bisects only above them
+		{3, 64, func(threads int) float64 { return math.Min(float64(threads), 10) }, 12, []int{3, 6, 12, 24, 18, 15, 13}},
+	}
+	for _, test := range tests {
+		threadsMin, threadsMax = test.min, test.max
+		var tested []int
+		seen := make(map[int]bool)
+		threads, _ := bisectSaturation(func(threads int) result {
+			if !seen[threads] {
+				seen[threads] = true
+				tested = append(tested, threads)
+			}
+			return result{Throughput: test.curve(threads)}
+		})
+		if threads != test.expected || !reflect.DeepEqual(tested, test.tested) {
+			t.Errorf("Expected the knee at %d threads after testing %v, got %d threads after testing %v", test.expected, test.tested, threads, tested)
+		}
+	}
+}
+
+func TestSaturationSearchStartsAtOneThread(t *testing.T) {
+	defer parseFlags(nil)
+
+	parseFlags([]string{"-saturation"})
+	if threadsMin != 1 {
+		t.Fatalf("Expected the search to start at 1 thread, got %d", threadsMin)
+	}
+
+	parseFlags([]string{"-saturation", "-threads-min=4"})
+	if threadsMin != 4 {
+		t.Fatalf("Expected the search to start at the threads-min argument, got %d", threadsMin)
+	}
+}
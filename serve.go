@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a minimal S3-compatible HTTP server with path-style requests, which serves the objects of an object store with a
+// simulated latency, bandwidth and error rate
+type s3Server struct {
+	store objectStore
+
+	// the time every request waits before it responds, i.e. the time to first byte
+	latency latencyDistribution
+
+	// the bandwidth in bytes per second of every request or response body, and of all of them together, if set
+	bandwidth float64
+	shared    *bandwidthLimiter
+
+	// the share of requests that fail with a 503 SlowDown, between 0 and 1
+	errorRate float64
+}
+
+// a distribution of the latencies of the server
+type latencyDistribution struct {
+	// fixed, uniform, normal or exponential
+	name string
+
+	// the mean latency, and the half width of the uniform distribution or the standard deviation of the normal one
+	mean   time.Duration
+	jitter time.Duration
+}
+
+// runs an S3-compatible server backed by memory or a directory, which the benchmarks can use with the endpoint argument
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addressArg := flags.String("address", "localhost:9000", "The address to listen on.")
+	dirArg := flags.String("dir", "", "If set, stores the objects in files in this directory instead of in memory.")
+	latencyArg := flags.Duration("latency", 0, "The mean latency of every request, before it responds.")
+	jitterArg := flags.Duration("latency-jitter", 0, "The jitter of the latencies, which is the half width of the uniform distribution or the standard deviation of the normal distribution.")
+	distributionArg := flags.String("latency-distribution", "fixed", "The distribution of the latencies: fixed, uniform, normal or exponential.")
+	bandwidthArg := flags.Float64("bandwidth-mb", 0, "If set, limits the bandwidth of every request and response body to this many MB/s.")
+	totalBandwidthArg := flags.Float64("total-bandwidth-mb", 0, "If set, limits the bandwidth of all the request and response bodies together to this many MB/s.")
+	errorRateArg := flags.Float64("error-rate", 0, "The share of requests that fail with a 503 SlowDown error, between 0 and 1.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: s3-benchmark serve [options]")
+		fmt.Fprintln(flags.Output(), "Runs a minimal S3-compatible server for path-style requests, to benchmark with -endpoint=http://<address>.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	server := &s3Server{
+		latency:   parseLatencyDistribution(*distributionArg, *latencyArg, *jitterArg),
+		bandwidth: *bandwidthArg * 1024 * 1024,
+		errorRate: *errorRateArg,
+	}
+	if *totalBandwidthArg > 0 {
+		server.shared = &bandwidthLimiter{bandwidth: *totalBandwidthArg * 1024 * 1024}
+	}
+
+	backend := "memory"
+	if *dirArg != "" {
+		server.store = newDiskStore(*dirArg)
+		backend = *dirArg
+	} else {
+		server.store = newMemoryStore()
+	}
+
+	listener, err := net.Listen("tcp", *addressArg)
+	if err != nil {
+		panic("Failed to listen on " + *addressArg + ": " + err.Error())
+	}
+
+	fmt.Printf("Serving S3 from \033[1;33m%s\033[0m at \033[1;33mhttp://%s\033[0m, benchmark it with -endpoint=http://%s\n",
+		backend, listener.Addr(), listener.Addr())
+
+	if err := http.Serve(listener, server); err != nil {
+		panic("Failed to serve S3: " + err.Error())
+	}
+	return 0
+}
+
+// parses the latency distribution of the serve subcommand
+func parseLatencyDistribution(name string, mean time.Duration, jitter time.Duration) latencyDistribution {
+	switch name {
+	case "fixed", "uniform", "normal", "exponential":
+		return latencyDistribution{name: name, mean: mean, jitter: jitter}
+	}
+	panic("Unknown latency distribution: " + name)
+}
+
+// returns a random latency of the distribution, which is never negative
+func (d latencyDistribution) sample() time.Duration {
+	latency := d.mean
+	switch d.name {
+	case "uniform":
+		latency += time.Duration((rand.Float64()*2 - 1) * float64(d.jitter))
+	case "normal":
+		latency += time.Duration(rand.NormFloat64() * float64(d.jitter))
+	case "exponential":
+		latency = time.Duration(rand.ExpFloat64() * float64(d.mean))
+	}
+
+	if latency < 0 {
+		return 0
+	}
+	return latency
+}
+
+// handles an S3 request, where the first segment of the path is the bucket and the rest is the key
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key := path, ""
+	if i := strings.Index(path, "/"); i >= 0 {
+		bucket, key = path[:i], path[i+1:]
+	}
+	query := r.URL.Query()
+
+	// the request body streams into the store, and the latency delays the response until after it's received, so that
+	// the latency is the time to first byte of the response
+	delayed := &delayedResponse{ResponseWriter: w, delay: s.latency.sample()}
+	w = delayed
+	body := s.body(r)
+
+	var err error
+	switch {
+	case s.errorRate > 0 && rand.Float64() < s.errorRate:
+		err = errSlowDown()
+	case bucket == "":
+		err = &storeError{"NotImplemented", "Listing the buckets is not implemented.", 501}
+	case key == "" && r.Method == http.MethodPut:
+		err = s.store.CreateBucket(r.Context(), bucket, "")
+	case key == "" && r.Method == http.MethodGet:
+		err = s.listObjects(w, r, bucket)
+	case key == "" && r.Method == http.MethodHead:
+		_, _, err = s.store.ListObjects(r.Context(), bucket, "", 1, nil)
+	case key == "" && r.Method == http.MethodPost && query["delete"] != nil:
+		err = s.deleteObjects(w, r, bucket, body)
+	case key == "":
+		err = &storeError{"NotImplemented", "This bucket operation is not implemented.", 501}
+	case r.Method == http.MethodGet:
+		err = s.getObject(w, r, bucket, key)
+	case r.Method == http.MethodHead:
+		var size int64
+		if size, err = s.store.HeadObject(r.Context(), bucket, key); err == nil {
+			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+	case r.Method == http.MethodPut && query.Get("uploadId") != "":
+		err = s.uploadPart(w, r, bucket, key, body)
+	case r.Method == http.MethodPut && r.Header.Get("x-amz-copy-source") != "":
+		err = s.copyObject(w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		digest := md5.New()
+		if err = s.store.PutObject(r.Context(), bucket, key, io.TeeReader(body, digest)); err == nil {
+			w.Header().Set("ETag", etag(digest))
+		}
+	case r.Method == http.MethodDelete && query.Get("uploadId") != "":
+		if err = s.store.AbortMultipartUpload(r.Context(), bucket, key, query.Get("uploadId")); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case r.Method == http.MethodDelete:
+		if err = s.store.DeleteObject(r.Context(), bucket, key); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case r.Method == http.MethodPost && query["uploads"] != nil:
+		err = s.createMultipartUpload(w, r, bucket, key)
+	case r.Method == http.MethodPost && query.Get("uploadId") != "":
+		err = s.completeMultipartUpload(w, r, bucket, key, body)
+	default:
+		err = &storeError{"NotImplemented", "This object operation is not implemented.", 501}
+	}
+
+	// the rest of the body is received before the response, e.g. that of a request that fails
+	_, _ = io.Copy(ioutil.Discard, body)
+	if err != nil {
+		s.writeError(w, r, err)
+	}
+	delayed.wait()
+}
+
+// a response that waits for the latency of the server before it starts
+type delayedResponse struct {
+	http.ResponseWriter
+	delay  time.Duration
+	waited bool
+}
+
+// waits for the latency, unless the response already started
+func (w *delayedResponse) wait() {
+	if !w.waited {
+		w.waited = true
+		time.Sleep(w.delay)
+	}
+}
+
+func (w *delayedResponse) WriteHeader(status int) {
+	w.wait()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *delayedResponse) Write(content []byte) (int, error) {
+	w.wait()
+	return w.ResponseWriter.Write(content)
+}
+
+// returns the request body, read at the bandwidth of the server, and decoded on the fly if the client signed it in
+// chunks
+func (s *s3Server) body(r *http.Request) io.Reader {
+	var body io.Reader = s.limit(r.Body)
+	if strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") {
+		body = &chunkedReader{reader: bufio.NewReader(body)}
+	}
+	return requestBody{body}
+}
+
+// a request body, which fails to read like S3 does if the body is incomplete
+type requestBody struct {
+	reader io.Reader
+}
+
+func (b requestBody) Read(p []byte) (int, error) {
+	n, err := b.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = &storeError{"IncompleteBody", "Failed to read the request body: " + err.Error(), 400}
+	}
+	return n, err
+}
+
+// returns the reader limited to the bandwidth of the server
+func (s *s3Server) limit(reader io.Reader) io.Reader {
+	if s.bandwidth == 0 && s.shared == nil {
+		return reader
+	}
+	return &bandwidthReader{reader: reader, bandwidth: s.bandwidth, start: time.Now(), shared: s.shared}
+}
+
+// a reader that decodes a body in the aws-chunked encoding, where every chunk is preceded by its hex size and signature,
+// e.g. "400;chunk-signature=...\r\n<1024 bytes>\r\n", and the last chunk is empty
+type chunkedReader struct {
+	reader *bufio.Reader
+
+	// the bytes left of the current chunk, whether a chunk was read, and whether the last chunk was
+	left    int64
+	started bool
+	done    bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.left == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > c.left {
+		p = p[:c.left]
+	}
+	n, err := c.reader.Read(p)
+	c.left -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// reads the size of the next chunk
+func (c *chunkedReader) nextChunk() error {
+	// skip the line break after the previous chunk
+	if c.started {
+		if _, err := c.reader.Discard(2); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	c.started = true
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(strings.SplitN(line, ";", 2)[0]), 16, 64)
+	if err != nil || size < 0 {
+		return fmt.Errorf("invalid chunk size: %q", line)
+	}
+
+	c.left, c.done = size, size == 0
+	return nil
+}
+
+// responds with the object, or the range of the Range header
+func (s *s3Server) getObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	size, err := s.store.HeadObject(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+
+	byteRange := r.Header.Get("Range")
+	start, end, status := 0, int(size), http.StatusOK
+	if byteRange != "" {
+		var ok bool
+		if start, end, ok = parseByteRange(byteRange, int(size)); !ok {
+			return errInvalidRange()
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	}
+
+	body, err := s.store.GetObject(r.Context(), bucket, key, byteRange)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Length", strconv.Itoa(end-start))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.WriteHeader(status)
+	_, _ = io.Copy(w, s.limit(body))
+	return nil
+}
+
+// the response of the CopyObject requests
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	LastModified string   `xml:"LastModified"`
+	ETag         string   `xml:"ETag"`
+}
+
+// copies an object within the bucket, where the source is in the x-amz-copy-source header
+func (s *s3Server) copyObject(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	source, err := url.PathUnescape(strings.TrimPrefix(r.Header.Get("x-amz-copy-source"), "/"))
+	if err != nil || !strings.HasPrefix(source, bucket+"/") {
+		return &storeError{"NotImplemented", "Only copies within the bucket are implemented.", 501}
+	}
+
+	if err := s.store.CopyObject(r.Context(), bucket, strings.TrimPrefix(source, bucket+"/"), key); err != nil {
+		return err
+	}
+	writeXML(w, copyObjectResult{LastModified: time.Now().UTC().Format(time.RFC3339)})
+	return nil
+}
+
+// the response of the ListObjectsV2 requests
+type listBucketResult struct {
+	XMLName               xml.Name          `xml:"ListBucketResult"`
+	Name                  string            `xml:"Name"`
+	Prefix                string            `xml:"Prefix"`
+	KeyCount              int               `xml:"KeyCount"`
+	MaxKeys               int               `xml:"MaxKeys"`
+	IsTruncated           bool              `xml:"IsTruncated"`
+	ContinuationToken     string            `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string            `xml:"NextContinuationToken,omitempty"`
+	Contents              []listBucketEntry `xml:"Contents"`
+}
+
+// an object of the ListObjectsV2 responses
+type listBucketEntry struct {
+	Key          string `xml:"Key"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+// lists the objects of the bucket with the ListObjectsV2 parameters
+func (s *s3Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+
+	maxKeys := 1000
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil && n >= 0 && n < maxKeys {
+		maxKeys = n
+	}
+
+	// the continuation token is the last key of the previous page, and listing starts after the start-after key too
+	var token *string
+	if t := query.Get("continuation-token"); t != "" {
+		token = &t
+	} else if t := query.Get("start-after"); t != "" {
+		token = &t
+	}
+
+	result := listBucketResult{
+		Name:              bucket,
+		Prefix:            query.Get("prefix"),
+		MaxKeys:           maxKeys,
+		ContinuationToken: query.Get("continuation-token"),
+	}
+
+	// a page of no keys doesn't need a request to the store, other than to check that the bucket exists
+	limit := maxKeys
+	if limit == 0 {
+		limit = 1
+	}
+	keys, next, err := s.store.ListObjects(r.Context(), bucket, result.Prefix, limit, token)
+	if err != nil {
+		return err
+	}
+	if maxKeys == 0 {
+		keys, next = nil, nil
+	}
+
+	for _, key := range keys {
+		// objects deleted while listing are left out
+		size, err := s.store.HeadObject(r.Context(), bucket, key)
+		if err != nil {
+			continue
+		}
+		result.Contents = append(result.Contents, listBucketEntry{Key: key, Size: size, StorageClass: "STANDARD"})
+	}
+	result.KeyCount = len(result.Contents)
+	if next != nil {
+		result.IsTruncated = true
+		result.NextContinuationToken = *next
+	}
+
+	writeXML(w, result)
+	return nil
+}
+
+// the request and response of the DeleteObjects requests
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key string `xml:"Key"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Deleted []struct {
+		Key string `xml:"Key"`
+	} `xml:"Deleted"`
+}
+
+// deletes the objects of the DeleteObjects request
+func (s *s3Server) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string, body io.Reader) error {
+	var request deleteRequest
+	if err := readXML(body, &request); err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, object := range request.Objects {
+		keys = append(keys, object.Key)
+	}
+	if err := s.store.DeleteObjects(r.Context(), bucket, keys); err != nil {
+		return err
+	}
+
+	var result deleteResult
+	if !request.Quiet {
+		result.Deleted = request.Objects
+	}
+	writeXML(w, result)
+	return nil
+}
+
+// the response of the CreateMultipartUpload requests
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// starts a multipart upload
+func (s *s3Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) error {
+	id, err := s.store.CreateMultipartUpload(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+	writeXML(w, initiateMultipartUploadResult{Bucket: bucket, Key: key, UploadID: id})
+	return nil
+}
+
+// uploads a part of a multipart upload, and responds with its ETag
+func (s *s3Server) uploadPart(w http.ResponseWriter, r *http.Request, bucket string, key string, body io.Reader) error {
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		return &storeError{"InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive", 400}
+	}
+
+	etag, err := s.store.UploadPart(r.Context(), bucket, key, r.URL.Query().Get("uploadId"), partNumber, body)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	return nil
+}
+
+// the request and response of the CompleteMultipartUpload requests
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+}
+
+// completes a multipart upload with the parts of the request, which must be numbered from 1 without gaps
+func (s *s3Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string, body io.Reader) error {
+	var request completeMultipartUpload
+	if err := readXML(body, &request); err != nil {
+		return err
+	}
+
+	sort.Slice(request.Parts, func(i, j int) bool { return request.Parts[i].PartNumber < request.Parts[j].PartNumber })
+	etags := make([]string, len(request.Parts))
+	for i, part := range request.Parts {
+		if part.PartNumber != i+1 {
+			return errInvalidPart()
+		}
+		etags[i] = part.ETag
+	}
+
+	if err := s.store.CompleteMultipartUpload(r.Context(), bucket, key, r.URL.Query().Get("uploadId"), etags); err != nil {
+		return err
+	}
+	writeXML(w, completeMultipartUploadResult{Bucket: bucket, Key: key})
+	return nil
+}
+
+// the response of the failed requests
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// responds with the error, with the status code and error code of S3 if it's an error of the store
+func (s *s3Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	response := errorResponse{Code: "InternalError", Message: err.Error(), Resource: r.URL.Path, RequestID: "local"}
+	status := http.StatusInternalServerError
+
+	var e *storeError
+	if errors.As(err, &e) {
+		response.Code, response.Message, status = e.code, e.message, e.statusCode
+	}
+
+	// the responses to HEAD requests have no body
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(response)
+}
+
+// reads the XML document of the request body, which is small enough to read at once
+func readXML(body io.Reader, document interface{}) error {
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(content, document); err != nil {
+		return &storeError{"MalformedXML", "The XML you provided was not well-formed.", 400}
+	}
+	return nil
+}
+
+// responds with the XML document
+func writeXML(w http.ResponseWriter, document interface{}) {
+	content, err := xml.Marshal(document)
+	if err != nil {
+		panic("Failed to encode the response: " + err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = io.WriteString(w, xml.Header)
+	_, _ = w.Write(content)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// sends a request to the server, and returns the status code, headers and body of the response
+func serveRequest(t *testing.T, server *httptest.Server, method string, path string, body string, headers ...string) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create the request: %v", err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read the response of %s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, resp.Header, string(content)
+}
+
+// checks the S3 operations of the benchmarks against a server of the store
+func testServeOperations(t *testing.T, s objectStore) {
+	server := httptest.NewServer(&s3Server{store: s, latency: latencyDistribution{name: "fixed"}})
+	defer server.Close()
+
+	expect := func(method string, path string, body string, status int, headers ...string) (http.Header, string) {
+		t.Helper()
+		code, header, content := serveRequest(t, server, method, path, body, headers...)
+		if code != status {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, status, code, content)
+		}
+		return header, content
+	}
+
+	expect("PUT", "/bucket/key", "content", 404)
+	expect("PUT", "/bucket", "", 200)
+	expect("PUT", "/bucket", "", 409)
+
+	header, _ := expect("PUT", "/bucket/a/key", "0123456789", 200)
+	if etag := fmt.Sprintf("\"%x\"", md5.Sum([]byte("0123456789"))); header.Get("ETag") != etag {
+		t.Fatalf("Expected the ETag %s, got %s", etag, header.Get("ETag"))
+	}
+	if _, body := expect("GET", "/bucket/a/key", "", 200); body != "0123456789" {
+		t.Fatalf("Expected the object, got %q", body)
+	}
+	if header, _ := expect("HEAD", "/bucket/a/key", "", 200); header.Get("Content-Length") != "10" {
+		t.Fatalf("Expected a length of 10, got %s", header.Get("Content-Length"))
+	}
+	expect("HEAD", "/bucket/missing", "", 404)
+
+	// ranged gets
+	header, body := expect("GET", "/bucket/a/key", "", 206, "Range", "bytes=2-5")
+	if body != "2345" || header.Get("Content-Range") != "bytes 2-5/10" {
+		t.Fatalf("Expected the range 2-5, got %q and %s", body, header.Get("Content-Range"))
+	}
+	expect("GET", "/bucket/a/key", "", 416, "Range", "bytes=10-20")
+
+	// chunked uploads of clients that sign every chunk
+	expect("PUT", "/bucket/chunked", "5;chunk-signature=abc\r\nhello\r\n0;chunk-signature=def\r\n\r\n", 200,
+		"x-amz-content-sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+	if _, body := expect("GET", "/bucket/chunked", "", 200); body != "hello" {
+		t.Fatalf("Expected the decoded object, got %q", body)
+	}
+
+	expect("PUT", "/bucket/copy", "", 200, "x-amz-copy-source", "/bucket/a/key")
+	if _, body := expect("GET", "/bucket/copy", "", 200); body != "0123456789" {
+		t.Fatalf("Expected the copied object, got %q", body)
+	}
+
+	// listing in pages
+	_, body = expect("GET", "/bucket?list-type=2&max-keys=2", "", 200)
+	if !strings.Contains(body, "<Key>a/key</Key><Size>10</Size>") || !strings.Contains(body, "<IsTruncated>true</IsTruncated>") ||
+		!strings.Contains(body, "<NextContinuationToken>chunked</NextContinuationToken>") {
+		t.Fatalf("Expected the first page of 2 keys, got %s", body)
+	}
+	_, body = expect("GET", "/bucket?list-type=2&continuation-token=chunked", "", 200)
+	if !strings.Contains(body, "<Key>copy</Key>") || !strings.Contains(body, "<KeyCount>1</KeyCount>") {
+		t.Fatalf("Expected the last page of 1 key, got %s", body)
+	}
+
+	// multipart uploads
+	_, body = expect("POST", "/bucket/multipart?uploads", "", 200)
+	id := body[strings.Index(body, "<UploadId>")+len("<UploadId>") : strings.Index(body, "</UploadId>")]
+	first, _ := expect("PUT", "/bucket/multipart?partNumber=1&uploadId="+id, "first ", 200)
+	second, _ := expect("PUT", "/bucket/multipart?partNumber=2&uploadId="+id, "second", 200)
+	expect("POST", "/bucket/multipart?uploadId="+id, fmt.Sprintf("<CompleteMultipartUpload>"+
+		"<Part><PartNumber>2</PartNumber><ETag>%s</ETag></Part>"+
+		"<Part><PartNumber>1</PartNumber><ETag>%s</ETag></Part>"+
+		"</CompleteMultipartUpload>", second.Get("ETag"), first.Get("ETag")), 200)
+	if _, body := expect("GET", "/bucket/multipart", "", 200); body != "first second" {
+		t.Fatalf("Expected the parts in order, got %q", body)
+	}
+	_, body = expect("POST", "/bucket/aborted?uploads", "", 200)
+	id = body[strings.Index(body, "<UploadId>")+len("<UploadId>") : strings.Index(body, "</UploadId>")]
+	expect("DELETE", "/bucket/aborted?uploadId="+id, "", 204)
+	expect("PUT", "/bucket/aborted?partNumber=1&uploadId="+id, "part", 404)
+
+	// deletes
+	expect("DELETE", "/bucket/copy", "", 204)
+	expect("GET", "/bucket/copy", "", 404)
+	expect("POST", "/bucket?delete", "<Delete><Quiet>true</Quiet><Object><Key>a/key</Key></Object>"+
+		"<Object><Key>chunked</Key></Object><Object><Key>multipart</Key></Object></Delete>", 200)
+	if _, body := expect("GET", "/bucket?list-type=2", "", 200); strings.Contains(body, "<Contents>") {
+		t.Fatalf("Expected no objects, got %s", body)
+	}
+}
+
+func TestServeMemory(t *testing.T) {
+	testServeOperations(t, newMemoryStore())
+}
+
+func TestServeDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3-benchmark")
+	if err != nil {
+		t.Fatalf("Failed to create a directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testServeOperations(t, newDiskStore(dir))
+}
+
+func TestServeErrors(t *testing.T) {
+	server := httptest.NewServer(&s3Server{store: newMemoryStore(), latency: latencyDistribution{name: "fixed"}, errorRate: 1})
+	defer server.Close()
+
+	status, _, body := serveRequest(t, server, "PUT", "/bucket", "")
+	if status != 503 || !strings.Contains(body, "<Code>SlowDown</Code>") {
+		t.Fatalf("Expected a SlowDown error, got %d: %s", status, body)
+	}
+}
+
+func TestChunkedReader(t *testing.T) {
+	// chunks of different sizes, read a few bytes at a time
+	chunks := "a;chunk-signature=abc\r\n0123456789\r\n3;chunk-signature=def\r\nabc\r\n0;chunk-signature=ghi\r\n\r\n"
+	content, err := ioutil.ReadAll(iotest.OneByteReader(&chunkedReader{reader: bufio.NewReader(strings.NewReader(chunks))}))
+	if err != nil || string(content) != "0123456789abc" {
+		t.Fatalf("Expected the decoded chunks, got %q and %v", content, err)
+	}
+
+	for _, truncated := range []string{"a;chunk-signature=abc\r\n01234", "3;chunk-signature=abc\r\nabc\r\n", "x;chunk-signature=abc\r\n"} {
+		if _, err := ioutil.ReadAll(&chunkedReader{reader: bufio.NewReader(strings.NewReader(truncated))}); err == nil {
+			t.Fatalf("Expected %q to fail", truncated)
+		}
+	}
+
+	// the server responds to an incomplete body like S3
+	server := httptest.NewServer(&s3Server{store: newMemoryStore(), latency: latencyDistribution{name: "fixed"}})
+	defer server.Close()
+	serveRequest(t, server, "PUT", "/bucket", "")
+	status, _, body := serveRequest(t, server, "PUT", "/bucket/key", "a;chunk-signature=abc\r\n01234",
+		"x-amz-content-sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+	if status != 400 || !strings.Contains(body, "<Code>IncompleteBody</Code>") {
+		t.Fatalf("Expected an IncompleteBody error, got %d: %s", status, body)
+	}
+}
+
+func TestServeLatency(t *testing.T) {
+	server := httptest.NewServer(&s3Server{store: newMemoryStore(), latency: latencyDistribution{name: "fixed", mean: 20 * time.Millisecond}})
+	defer server.Close()
+
+	start := time.Now()
+	serveRequest(t, server, "PUT", "/bucket", "")
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("Expected a latency of at least 20 ms, got %v", elapsed)
+	}
+}
+
+func TestLatencyDistributions(t *testing.T) {
+	for _, name := range []string{"fixed", "uniform", "normal", "exponential"} {
+		d := parseLatencyDistribution(name, 10*time.Millisecond, 5*time.Millisecond)
+
+		var total time.Duration
+		for i := 0; i < 10000; i++ {
+			latency := d.sample()
+			if latency < 0 {
+				t.Fatalf("%s: expected no negative latencies, got %v", name, latency)
+			}
+			total += latency
+		}
+
+		if mean := total / 10000; mean < 9*time.Millisecond || mean > 11*time.Millisecond {
+			t.Errorf("%s: expected a mean of about 10 ms, got %v", name, mean)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// the S3 operations used by the benchmarks, which S3 itself implements through the AWS SDK, and the in-memory and disk
+// stores implement for the tests and the serve subcommand, where the errors have the same messages as those of the SDK
+type objectStore interface {
+	CreateBucket(ctx context.Context, bucket string, region string) error
+
+	// gets the object, or the given HTTP byte range of it if not empty, e.g. "bytes=0-99"
+	GetObject(ctx context.Context, bucket string, key string, byteRange string) (io.ReadCloser, error)
+	PutObject(ctx context.Context, bucket string, key string, body io.Reader) error
+
+	// returns the size of the object
+	HeadObject(ctx context.Context, bucket string, key string) (int64, error)
+	CopyObject(ctx context.Context, bucket string, source string, destination string) error
+	DeleteObject(ctx context.Context, bucket string, key string) error
+
+	// deletes the objects in one request, which fails if any of the objects can't be deleted
+	DeleteObjects(ctx context.Context, bucket string, keys []string) error
+
+	// lists a page of at most the given number of keys with the prefix, or a page of the default size if 0, starting
+	// at the continuation token if not nil, and returns the token of the next page, which is nil after the last page
+	ListObjects(ctx context.Context, bucket string, prefix string, maxKeys int, token *string) ([]string, *string, error)
+
+	CreateMultipartUpload(ctx context.Context, bucket string, key string) (string, error)
+	UploadPart(ctx context.Context, bucket string, key string, uploadID string, partNumber int, body io.Reader) (string, error)
+
+	// completes the multipart upload with the ETags of all its parts, in the order of the part numbers
+	CompleteMultipartUpload(ctx context.Context, bucket string, key string, uploadID string, etags []string) error
+	AbortMultipartUpload(ctx context.Context, bucket string, key string, uploadID string) error
+}
+
+// the object store the benchmarks run against
+var store objectStore
+
+// an error of an object store other than S3, with the error code and HTTP status code that S3 responds with
+type storeError struct {
+	code       string
+	message    string
+	statusCode int
+}
+
+// formats the error like the errors of the AWS SDK, which the benchmarks classify by their message
+func (e *storeError) Error() string {
+	return fmt.Sprintf("%s: %s\n\tstatus code: %d, request id: local", e.code, e.message, e.statusCode)
+}
+
+// the errors of the object stores other than S3
+func errNoSuchBucket() error {
+	return &storeError{"NoSuchBucket", "The specified bucket does not exist", 404}
+}
+
+func errNotFound() error {
+	return &storeError{"NotFound", "Not Found", 404}
+}
+
+func errNoSuchUpload() error {
+	return &storeError{"NoSuchUpload", "The specified upload does not exist.", 404}
+}
+
+func errInvalidPart() error {
+	return &storeError{"InvalidPart", "One or more of the specified parts could not be found.", 400}
+}
+
+func errInvalidRange() error {
+	return &storeError{"InvalidRange", "The requested range is not satisfiable", 416}
+}
+
+func errBucketAlreadyOwnedByYou() error {
+	return &storeError{"BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", 409}
+}
+
+func errSlowDown() error {
+	return &storeError{"SlowDown", "Please reduce your request rate.", 503}
+}
+
+// the object store of S3 and other S3-compatible services, through the AWS SDK
+type awsStore struct {
+	client *s3.S3
+}
+
+func (s *awsStore) CreateBucket(ctx context.Context, bucket string, region string) error {
+	req := s.client.CreateBucketRequest(&s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+		CreateBucketConfiguration: &s3.CreateBucketConfiguration{
+			LocationConstraint: s3.NormalizeBucketLocation(s3.BucketLocationConstraint(region)),
+		},
+	})
+
+	// AWS S3 has this peculiar issue in which if you want to create bucket in us-east-1 region, you should NOT specify
+	// any location constraint. https://github.com/boto/boto3/issues/125
+	if strings.ToLower(region) == "us-east-1" {
+		req = s.client.CreateBucketRequest(&s3.CreateBucketInput{
+			Bucket: aws.String(bucket),
+		})
+	}
+
+	req.SetContext(ctx)
+	_, err := req.Send()
+	return err
+}
+
+func (s *awsStore) GetObject(ctx context.Context, bucket string, key string, byteRange string) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+
+	req := s.client.GetObjectRequest(input)
+	req.SetContext(ctx)
+	resp, err := req.Send()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *awsStore) PutObject(ctx context.Context, bucket string, key string, body io.Reader) error {
+	seeker, err := seekable(body)
+	if err != nil {
+		return err
+	}
+
+	req := s.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   seeker,
+	})
+	req.SetContext(ctx)
+	_, err = req.Send()
+	return err
+}
+
+func (s *awsStore) HeadObject(ctx context.Context, bucket string, key string) (int64, error) {
+	req := s.client.HeadObjectRequest(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	req.SetContext(ctx)
+	resp, err := req.Send()
+	if err != nil {
+		return 0, err
+	}
+	return aws.Int64Value(resp.ContentLength), nil
+}
+
+func (s *awsStore) CopyObject(ctx context.Context, bucket string, source string, destination string) error {
+	req := s.client.CopyObjectRequest(&s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(destination),
+		CopySource: aws.String(bucket + "/" + source),
+	})
+	req.SetContext(ctx)
+	_, err := req.Send()
+	return err
+}
+
+func (s *awsStore) DeleteObject(ctx context.Context, bucket string, key string) error {
+	req := s.client.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	req.SetContext(ctx)
+	_, err := req.Send()
+	return err
+}
+
+func (s *awsStore) DeleteObjects(ctx context.Context, bucket string, keys []string) error {
+	objects := make([]s3.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i] = s3.ObjectIdentifier{Key: aws.String(key)}
+	}
+
+	req := s.client.DeleteObjectsRequest(&s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+	})
+	req.SetContext(ctx)
+	resp, err := req.Send()
+	if err != nil {
+		return err
+	}
+
+	// the request succeeds even if some of the objects can't be deleted
+	if len(resp.Errors) > 0 {
+		return errors.New(aws.StringValue(resp.Errors[0].Code) + ": " + aws.StringValue(resp.Errors[0].Message))
+	}
+	return nil
+}
+
+func (s *awsStore) ListObjects(ctx context.Context, bucket string, prefix string, maxKeys int, token *string) ([]string, *string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:            aws.String(bucket),
+		Prefix:            aws.String(prefix),
+		ContinuationToken: token,
+	}
+	if maxKeys > 0 {
+		input.MaxKeys = aws.Int64(int64(maxKeys))
+	}
+
+	req := s.client.ListObjectsV2Request(input)
+	req.SetContext(ctx)
+	resp, err := req.Send()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	for _, object := range resp.Contents {
+		keys = append(keys, aws.StringValue(object.Key))
+	}
+
+	if !aws.BoolValue(resp.IsTruncated) {
+		return keys, nil, nil
+	}
+	return keys, resp.NextContinuationToken, nil
+}
+
+func (s *awsStore) CreateMultipartUpload(ctx context.Context, bucket string, key string) (string, error) {
+	req := s.client.CreateMultipartUploadRequest(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	req.SetContext(ctx)
+	resp, err := req.Send()
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.UploadId), nil
+}
+
+func (s *awsStore) UploadPart(ctx context.Context, bucket string, key string, uploadID string, partNumber int, body io.Reader) (string, error) {
+	seeker, err := seekable(body)
+	if err != nil {
+		return "", err
+	}
+
+	req := s.client.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(int64(partNumber)),
+		Body:       seeker,
+	})
+	req.SetContext(ctx)
+	resp, err := req.Send()
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.ETag), nil
+}
+
+func (s *awsStore) CompleteMultipartUpload(ctx context.Context, bucket string, key string, uploadID string, etags []string) error {
+	parts := make([]s3.CompletedPart, len(etags))
+	for i, etag := range etags {
+		parts[i] = s3.CompletedPart{ETag: aws.String(etag), PartNumber: aws.Int64(int64(i + 1))}
+	}
+
+	req := s.client.CompleteMultipartUploadRequest(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	req.SetContext(ctx)
+	_, err := req.Send()
+	return err
+}
+
+func (s *awsStore) AbortMultipartUpload(ctx context.Context, bucket string, key string, uploadID string) error {
+	req := s.client.AbortMultipartUploadRequest(&s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	req.SetContext(ctx)
+	_, err := req.Send()
+	return err
+}
+
+// returns the body as it is if it can seek, which the SDK needs to sign it, or read into memory otherwise, which the
+// benchmarks never need, since they upload from memory
+func seekable(body io.Reader) (io.ReadSeeker, error) {
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		return seeker, nil
+	}
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(content), nil
+}
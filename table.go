@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// a results table with some leading columns, followed by columns of latency summary statistics
+type table struct {
+	// the titles of the leading columns, padded with spaces to the width of the column
+	columns []string
+
+	// the number of columns of latency summary statistics
+	statsColumns int
+}
+
+// the results table of the benchmarks that measure single requests
+var threadsTable = table{columns: []string{" Threads ", "     Throughput ", "  Errors ", " Alloc/req ", " GC (ms) ", " CPU % ", "  Peak RSS ", "  NIC rx/tx MB/s ", " Bound "}, statsColumns: 2}
+
+// the results table of the throttling test, where the first column is the run number
+var throttlingTable = table{columns: []string{"       # ", "     Throughput ", "  Errors ", " Alloc/req ", " GC (ms) ", " CPU % ", "  Peak RSS ", "  NIC rx/tx MB/s ", " Bound "}, statsColumns: 2}
+
+// the results table of the benchmarks that split objects into parts
+var partsTable = table{columns: []string{" Part Size ", " Parts ", " Threads ", "     Throughput ", "  Errors ", " Alloc/obj ", " GC (ms) ", " CPU % ", "  Peak RSS ", "  NIC rx/tx MB/s ", " Bound "}, statsColumns: 2}
+
+// returns the labels of the summary statistics, in the order of the results table columns
+func statLabels() []string {
+	labels := []string{"avg", "std", "min"}
+	for _, q := range percentiles {
+		labels = append(labels, percentileLabel(q))
+	}
+	return append(labels, "max")
+}
+
+// returns the width of every summary statistic in the results table, which fits the longest label
+func statWidth() int {
+	width := 5
+	for _, label := range statLabels() {
+		if len(label) > width {
+			width = len(label)
+		}
+	}
+	return width
+}
+
+// returns the width of a column of summary statistics in the results table
+func statsColumnWidth() int {
+	return len(statLabels()) * (statWidth() + 1)
+}
+
+// formats the summary statistics of some latencies as a column of the results table, which is empty without latencies
+func statsColumn(s summary) string {
+	width := statWidth()
+	if s.count == 0 {
+		return strings.Repeat(" ", statsColumnWidth())
+	}
+
+	column := ""
+	for _, value := range s.values() {
+		column += fmt.Sprintf("%*.0f ", width, value)
+	}
+	return column
+}
+
+// returns the summary statistics in the order of the results table columns
+func (s summary) values() []float64 {
+	values := []float64{s.avg, s.stddev, s.min}
+	values = append(values, s.percentiles...)
+	return append(values, s.max)
+}
+
+// returns the width of the leading columns, including their separators
+func (t table) leadingWidth() int {
+	width := 1
+	for _, column := range t.columns {
+		width += len(column) + 1
+	}
+	return width
+}
+
+// returns the separator line of the table
+func (t table) separator() string {
+	line := "+"
+	for _, column := range t.columns {
+		line += strings.Repeat("-", len(column)) + "+"
+	}
+	for i := 0; i < t.statsColumns; i++ {
+		line += strings.Repeat("-", statsColumnWidth()) + "+"
+	}
+	return line
+}
+
+// prints the column headers of the table, with the given titles of the latency columns
+func (t table) printHeader(titles ...string) {
+	indent := strings.Repeat(" ", t.leadingWidth()-1)
+	width := statsColumnWidth()
+
+	labels := ""
+	for _, label := range statLabels() {
+		labels += fmt.Sprintf("%*s ", statWidth(), label)
+	}
+
+	titleLine := indent + "|"
+	labelLine := "|" + strings.Join(t.columns, "|") + "|"
+	for _, title := range titles {
+		titleLine += centerText(title, width) + "|"
+		labelLine += labels + "|"
+	}
+
+	fmt.Fprintln(console, indent+"+"+strings.Repeat("-", t.statsColumns*(width+1)-1)+"+")
+	fmt.Fprintln(console, titleLine)
+	fmt.Fprintln(console, t.separator())
+	fmt.Fprintln(console, labelLine)
+	fmt.Fprintln(console, t.separator())
+}
+
+// prints the last line of the table
+func (t table) printFooter() {
+	fmt.Fprint(console, t.separator()+"\n\n")
+}
+
+// returns the label of a percentile, e.g. "p99.9"
+func percentileLabel(q float64) string {
+	return "p" + strconv.FormatFloat(q, 'f', -1, 64)
+}
+
+// parses the comma separated percentiles argument, e.g. "50,99,99.9"
+func parsePercentiles(list string) []float64 {
+	var result []float64
+	for _, part := range strings.Split(list, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || q <= 0 || q >= 100 {
+			panic("Invalid percentile, it must be between 0 and 100: " + part)
+		}
+		result = append(result, q)
+	}
+	return result
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the CPU usage of the whole host or of this process, and the share of the link speed of its network interfaces, in
+// percent, above which the client counts as the bottleneck of a test
+const clientBoundCPU = 90
+const clientBoundNIC = 90
+
+// the clock ticks per second of the CPU times in /proc, which is 100 on all the common architectures
+const clockTicks = 100
+
+// how often the resources of the client are sampled while a test is running
+const telemetryInterval = 250 * time.Millisecond
+
+// the resources of the client at one point in time, read from /proc, which is only available on Linux
+type resourceSample struct {
+	ok   bool
+	time time.Time
+
+	// the CPU time of all the cores in clock ticks, and the part of it that wasn't idle
+	cpuTotal uint64
+	cpuBusy  uint64
+
+	// the CPU time of this process in clock ticks, in user and system mode
+	processCPU uint64
+
+	// the resident memory of this process in bytes
+	rss uint64
+
+	// the bytes received and sent by all the network interfaces other than the loopback interface
+	rxBytes uint64
+	txBytes uint64
+}
+
+// the resources of the client during a test, which show whether its CPU or network limited the throughput
+type telemetry struct {
+	start time.Time
+	first resourceSample
+
+	// the samples taken while the test is running, until it stops
+	lock    sync.Mutex
+	last    resourceSample
+	seconds float64
+	peakCPU float64
+	peakRSS uint64
+
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// starts sampling the resources of the client for a test
+func startTelemetry() *telemetry {
+	t := &telemetry{start: time.Now(), first: readResourceSample(), done: make(chan struct{})}
+	t.last = t.first
+	t.peakRSS = t.first.rss
+
+	t.stopped.Add(1)
+	go func() {
+		defer t.stopped.Done()
+		ticker := time.NewTicker(telemetryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.sample()
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// takes a sample of the resources, and keeps the peak CPU usage since the last sample and the peak memory
+func (t *telemetry) sample() {
+	s := readResourceSample()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if cpu := cpuPercent(t.last, s); cpu > t.peakCPU {
+		t.peakCPU = cpu
+	}
+	if s.rss > t.peakRSS {
+		t.peakRSS = s.rss
+	}
+	t.last = s
+	t.seconds = time.Now().Sub(t.start).Seconds()
+}
+
+// stops sampling the resources at the end of a test, with a last sample
+func (t *telemetry) stop() {
+	close(t.done)
+	t.stopped.Wait()
+	t.sample()
+}
+
+// returns the CPU usage between two samples, in percent of all the cores
+func cpuPercent(from resourceSample, to resourceSample) float64 {
+	if !from.ok || !to.ok || to.cpuTotal <= from.cpuTotal || to.cpuBusy < from.cpuBusy {
+		return 0
+	}
+	return float64(to.cpuBusy-from.cpuBusy) / float64(to.cpuTotal-from.cpuTotal) * 100
+}
+
+// returns the CPU usage of this process between two samples, in percent of the cores it can run Go code on at once,
+// which shows a client that is CPU bound on a large host where the usage of all the cores is low
+func processCPUPercent(from resourceSample, to resourceSample) float64 {
+	seconds := to.time.Sub(from.time).Seconds()
+	if !from.ok || !to.ok || seconds <= 0 || to.processCPU < from.processCPU {
+		return 0
+	}
+	return float64(to.processCPU-from.processCPU) / clockTicks / seconds / float64(runtime.GOMAXPROCS(0)) * 100
+}
+
+// returns the bytes received and sent over the network during the test
+func (t *telemetry) nicBytes() (uint64, uint64) {
+	if !t.first.ok || !t.last.ok {
+		return 0, 0
+	}
+	return counterDelta(t.first.rxBytes, t.last.rxBytes), counterDelta(t.first.txBytes, t.last.txBytes)
+}
+
+// returns the bytes per second received and sent over the network during the test
+func (t *telemetry) nicRates() (float64, float64) {
+	if t.seconds == 0 {
+		return 0, 0
+	}
+	rx, tx := t.nicBytes()
+	return float64(rx) / t.seconds, float64(tx) / t.seconds
+}
+
+// returns how much a counter grew, or 0 if it was reset, e.g. because a network interface went down
+func counterDelta(from uint64, to uint64) uint64 {
+	if to < from {
+		return 0
+	}
+	return to - from
+}
+
+// returns which resource of the client was the bottleneck of the test, cpu or nic, or empty if neither was
+func (t *telemetry) bound() string {
+	if cpuPercent(t.first, t.last) >= clientBoundCPU || processCPUPercent(t.first, t.last) >= clientBoundCPU {
+		return "cpu"
+	}
+
+	// the network interfaces are full duplex, so either direction can saturate
+	rx, tx := t.nicRates()
+	if speed := linkSpeed(); speed > 0 && (rx >= speed*clientBoundNIC/100 || tx >= speed*clientBoundNIC/100) {
+		return "nic"
+	}
+	return ""
+}
+
+// formats the CPU usage, peak memory, network rates and bottleneck of the client as the columns of the results table,
+// which are empty where /proc isn't available
+func (t *telemetry) columns() string {
+	if !t.first.ok {
+		return "       |           |                 |       "
+	}
+
+	rx, tx := t.nicRates()
+	return fmt.Sprintf(" %4.0f%% | %9s | %7.1f/%-7.1f | %5s ", cpuPercent(t.first, t.last), byteFormat(float64(t.peakRSS)),
+		rx/1024/1024, tx/1024/1024, t.bound())
+}
+
+// sets the resources of the client during the test in the results
+func (r *result) setTelemetry(t *telemetry) {
+	if !t.first.ok {
+		return
+	}
+
+	r.CPUPercent = cpuPercent(t.first, t.last)
+	r.CPUPercentMax = t.peakCPU
+	r.RSSBytes = t.peakRSS
+	r.NICRxBytes, r.NICTxBytes = t.nicBytes()
+	r.ClientBound = t.bound()
+}
+
+// reads the resources of the client from /proc, or returns a sample that isn't ok if they can't be read
+func readResourceSample() resourceSample {
+	stat, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return resourceSample{}
+	}
+	self, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return resourceSample{}
+	}
+	status, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		return resourceSample{}
+	}
+	dev, err := ioutil.ReadFile("/proc/net/dev")
+	if err != nil {
+		return resourceSample{}
+	}
+
+	s := resourceSample{ok: true, time: time.Now(), rss: parseProcRSS(status), processCPU: parseProcSelfStat(self)}
+	s.cpuTotal, s.cpuBusy = parseProcStat(stat)
+	s.rxBytes, s.txBytes = parseNetDev(dev)
+	return s
+}
+
+// parses the total and busy CPU time of all the cores from the first line of /proc/stat, e.g.
+// "cpu  4705 356 584 3699 23 23 0 0 0 0", where the fourth and fifth values are the idle and I/O wait times
+func parseProcStat(content []byte) (uint64, uint64) {
+	line := content
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		line = content[:i]
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0
+	}
+
+	// the guest times are part of the user times already, so only the first 8 values add up to the total
+	var total, idle uint64
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		v, _ := strconv.ParseUint(field, 10, 64)
+		total += v
+		if i == 3 || i == 4 {
+			idle += v
+		}
+	}
+	return total, total - idle
+}
+
+// parses the CPU time of this process in user and system mode from /proc/self/stat, e.g.
+// "1234 (s3-benchmark) S 1 1234 1234 0 -1 4194560 500 0 0 0 250 40 ...", where the user and system times are the
+// 14th and 15th values, and the name in parentheses may contain spaces
+func parseProcSelfStat(content []byte) uint64 {
+	i := bytes.LastIndexByte(content, ')')
+	if i < 0 {
+		return 0
+	}
+
+	// the values after the name start with the state, which is the 3rd value
+	fields := strings.Fields(string(content[i+1:]))
+	if len(fields) < 13 {
+		return 0
+	}
+	user, _ := strconv.ParseUint(fields[11], 10, 64)
+	system, _ := strconv.ParseUint(fields[12], 10, 64)
+	return user + system
+}
+
+// parses the resident memory in bytes from /proc/self/status, which has a line like "VmRSS:	  12345 kB"
+func parseProcRSS(content []byte) uint64 {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// parses the bytes received and sent by all the network interfaces other than the loopback interface from
+// /proc/net/dev, where every interface has a line like "  eth0: 1234 10 0 0 0 0 0 0 5678 20 0 0 0 0 0 0", with the
+// received bytes first and the sent bytes ninth
+func parseNetDev(content []byte) (uint64, uint64) {
+	var rx, tx uint64
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "lo" {
+			continue
+		}
+
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		t, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+	return rx, tx
+}
+
+// the link speed of the network interfaces, which is read once
+var linkSpeedOnce sync.Once
+var linkSpeedBytes float64
+
+// returns the total link speed in bytes per second of the network interfaces other than the loopback interface, or 0
+// if it isn't known, which is often the case for virtual interfaces
+func linkSpeed() float64 {
+	linkSpeedOnce.Do(func() {
+		interfaces, err := ioutil.ReadDir("/sys/class/net")
+		if err != nil {
+			return
+		}
+		for _, i := range interfaces {
+			if i.Name() == "lo" {
+				continue
+			}
+
+			// the speed is in Mbit/s, and -1 or unreadable if unknown
+			content, err := ioutil.ReadFile(filepath.Join("/sys/class/net", i.Name(), "speed"))
+			if err != nil {
+				continue
+			}
+			if mbits, err := strconv.ParseFloat(strings.TrimSpace(string(content)), 64); err == nil && mbits > 0 {
+				linkSpeedBytes += mbits * 1000 * 1000 / 8
+			}
+		}
+	})
+	return linkSpeedBytes
+}
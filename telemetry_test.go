@@ -0,0 +1,84 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	total, busy := parseProcStat([]byte("cpu  100 10 50 800 40 0 0 0 30 0\ncpu0 50 5 25 400 20 0 0 0 15 0\n"))
+
+	// the guest time is part of the user time, and the idle and I/O wait times aren't busy
+	if total != 1000 || busy != 160 {
+		t.Fatalf("Expected a total of 1000 and 160 busy, got %d and %d", total, busy)
+	}
+}
+
+func TestParseProcSelfStat(t *testing.T) {
+	// the name of the process may contain spaces and parentheses
+	ticks := parseProcSelfStat([]byte("1234 (s3 (bench)) S 1 1234 1234 0 -1 4194560 500 0 0 0 250 40 0 0 20 0 8 0 100 0 0\n"))
+
+	if ticks != 290 {
+		t.Fatalf("Expected 290 ticks, got %d", ticks)
+	}
+}
+
+func TestParseProcRSS(t *testing.T) {
+	rss := parseProcRSS([]byte("Name:\ts3-benchmark\nVmPeak:\t  900000 kB\nVmRSS:\t   12345 kB\nThreads:\t8\n"))
+
+	if rss != 12345*1024 {
+		t.Fatalf("Expected %d bytes, got %d", 12345*1024, rss)
+	}
+}
+
+func TestParseNetDev(t *testing.T) {
+	rx, tx := parseNetDev([]byte(`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 9999999    1000    0    0    0     0          0         0  9999999    1000    0    0    0     0       0          0
+  eth0:  1000      10    0    0    0     0          0         0     2000      20    0    0    0     0       0          0
+  eth1:   300       3    0    0    0     0          0         0      400       4    0    0    0     0       0          0
+`))
+
+	// the loopback interface doesn't count
+	if rx != 1300 || tx != 2400 {
+		t.Fatalf("Expected 1300 bytes received and 2400 sent, got %d and %d", rx, tx)
+	}
+}
+
+func TestTelemetryBound(t *testing.T) {
+	busy := &telemetry{
+		first:   resourceSample{ok: true, cpuTotal: 1000, cpuBusy: 100},
+		last:    resourceSample{ok: true, cpuTotal: 2000, cpuBusy: 1050},
+		seconds: 1,
+	}
+	if bound := busy.bound(); bound != "cpu" {
+		t.Fatalf("Expected a CPU bound test at 95%%, got %q", bound)
+	}
+
+	idle := &telemetry{
+		first:   resourceSample{ok: true, cpuTotal: 1000, cpuBusy: 100},
+		last:    resourceSample{ok: true, cpuTotal: 2000, cpuBusy: 300},
+		seconds: 1,
+	}
+	if bound := idle.bound(); bound == "cpu" {
+		t.Fatal("Expected a test at 20% CPU not to be CPU bound")
+	}
+
+	// a single saturated core of a large host is a low usage of the host, but not of this process
+	now := time.Now()
+	saturated := &telemetry{
+		first:   resourceSample{ok: true, time: now, cpuTotal: 1000, cpuBusy: 100},
+		last:    resourceSample{ok: true, time: now.Add(time.Second), cpuTotal: 2000, cpuBusy: 300, processCPU: uint64(95 * runtime.GOMAXPROCS(0))},
+		seconds: 1,
+	}
+	if bound := saturated.bound(); bound != "cpu" {
+		t.Fatalf("Expected a CPU bound test at 95%% of the process, got %q", bound)
+	}
+
+	var r result
+	r.setTelemetry(idle)
+	if r.CPUPercent != 20 {
+		t.Fatalf("Expected 20%% CPU, got %f", r.CPUPercent)
+	}
+}
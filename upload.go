@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// uploads an object of the given size for the given thread index, and measures the time until the whole request body
+// was sent and the time until the response was received
+func putObject(threadIndex int, payloadSize uint64) (latency, error) {
+	// generate an S3 key from the sha hash of the hostname, thread index, and object size
+	return putObjectKey(generateS3Key(hostname, threadIndex, payloadSize), payloadSize)
+}
+
+// uploads an object of the given size with the given key, and measures the request sent and response latencies
+func putObjectKey(key string, payloadSize uint64) (latency, error) {
+	// generate empty payload, and wrap it to find out when the SDK finished sending it
+	body := &timedReader{reader: bytes.NewReader(zeroPayload(payloadSize))}
+
+	// start the timer to measure the request sent and response latencies
+	latencyTimer := time.Now()
+
+	// do the PutObject request
+	ctx, trace := traceRequest()
+	err := store.PutObject(ctx, bucketName, key, body)
+
+	// if a request fails, fail the sample
+	if err != nil {
+		return latency{}, failRequest("Failed to put object", err)
+	}
+
+	// measure the response latency
+	response := time.Now().Sub(latencyTimer)
+
+	return trace.finish(latency{FirstByte: body.sentAfter(latencyTimer, response), LastByte: response}, latencyTimer), nil
+}
+
+// a request body that remembers the last time it was read to the end, in unix nanoseconds
+type timedReader struct {
+	exhausted int64
+	reader    *bytes.Reader
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err == io.EOF || r.reader.Len() == 0 {
+		// the transport may read the body on a different goroutine than the one waiting for the response
+		atomic.StoreInt64(&r.exhausted, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// returns how long after the start time the body was fully sent, which is bounded by the response latency
+func (r *timedReader) sentAfter(start time.Time, response time.Duration) time.Duration {
+	// the body is read to the end once more by the HTTP transport after signing, so the last time it was
+	// exhausted is when the request was fully sent
+	sent := time.Duration(atomic.LoadInt64(&r.exhausted) - start.UnixNano())
+	if sent <= 0 || sent > response {
+		sent = response
+	}
+	return sent
+}
+
+func (r *timedReader) Seek(offset int64, whence int) (int64, error) {
+	return r.reader.Seek(offset, whence)
+}